@@ -6,4 +6,5 @@ require (
 	github.com/dustin/go-wikiparse v0.0.0-20180421171717-b202c3048fd5
 	github.com/mattn/go-sqlite3 v1.14.8
 	github.com/pkg/errors v0.9.1
+	golang.org/x/text v0.14.0
 )
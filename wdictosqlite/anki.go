@@ -0,0 +1,623 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kissen/wikidictools/wikidictdb"
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Style sheet of the note type of exported decks.
+const ANKI_CSS = `.card { font-family: sans-serif; font-size: 20px; text-align: center; }
+.pron { color: gray; }
+.pos { font-style: italic; }
+ol { text-align: left; }
+`
+
+// Schema of the collection inside a package. This is the legacy schema
+// 11, which all versions of Anki still import.
+const ANKI_SCHEMA = `
+	CREATE TABLE col (
+		id INTEGER PRIMARY KEY, crt INTEGER NOT NULL, mod INTEGER NOT NULL,
+		scm INTEGER NOT NULL, ver INTEGER NOT NULL, dty INTEGER NOT NULL,
+		usn INTEGER NOT NULL, ls INTEGER NOT NULL, conf TEXT NOT NULL,
+		models TEXT NOT NULL, decks TEXT NOT NULL, dconf TEXT NOT NULL,
+		tags TEXT NOT NULL
+	);
+	CREATE TABLE notes (
+		id INTEGER PRIMARY KEY, guid TEXT NOT NULL, mid INTEGER NOT NULL,
+		mod INTEGER NOT NULL, usn INTEGER NOT NULL, tags TEXT NOT NULL,
+		flds TEXT NOT NULL, sfld INTEGER NOT NULL, csum INTEGER NOT NULL,
+		flags INTEGER NOT NULL, data TEXT NOT NULL
+	);
+	CREATE TABLE cards (
+		id INTEGER PRIMARY KEY, nid INTEGER NOT NULL, did INTEGER NOT NULL,
+		ord INTEGER NOT NULL, mod INTEGER NOT NULL, usn INTEGER NOT NULL,
+		type INTEGER NOT NULL, queue INTEGER NOT NULL, due INTEGER NOT NULL,
+		ivl INTEGER NOT NULL, factor INTEGER NOT NULL, reps INTEGER NOT NULL,
+		lapses INTEGER NOT NULL, left INTEGER NOT NULL, odue INTEGER NOT NULL,
+		odid INTEGER NOT NULL, flags INTEGER NOT NULL, data TEXT NOT NULL
+	);
+	CREATE TABLE revlog (
+		id INTEGER PRIMARY KEY, cid INTEGER NOT NULL, usn INTEGER NOT NULL,
+		ease INTEGER NOT NULL, ivl INTEGER NOT NULL, lastIvl INTEGER NOT NULL,
+		factor INTEGER NOT NULL, time INTEGER NOT NULL, type INTEGER NOT NULL
+	);
+	CREATE TABLE graves (
+		usn INTEGER NOT NULL, oid INTEGER NOT NULL, type INTEGER NOT NULL
+	);
+	CREATE INDEX ix_notes_usn ON notes (usn);
+	CREATE INDEX ix_cards_usn ON cards (usn);
+	CREATE INDEX ix_revlog_usn ON revlog (usn);
+	CREATE INDEX ix_cards_nid ON cards (nid);
+	CREATE INDEX ix_cards_sched ON cards (did, queue, due);
+	CREATE INDEX ix_revlog_cid ON revlog (cid);
+	CREATE INDEX ix_notes_csum ON notes (csum);`
+
+// Name of the note type of exported decks.
+const ANKI_MODEL_NAME = "wdictosqlite"
+
+// Writes flashcards with a front and a back in HTML.
+type ankiDeckWriter interface {
+	WriteCard(word, front, back string) error
+	Close() error
+}
+
+// Export words of a database as a deck of flashcards for Anki. Each card
+// has the word on the front and its pronunciations and definitions on
+// the back.
+func RunAnki(argv []string) error {
+	var (
+		sqlFile  string
+		outFile  string
+		format   string
+		wordList string
+		deck     string
+		rank     string
+		top      int
+	)
+
+	flags := flag.NewFlagSet(os.Args[0]+" anki", flag.ExitOnError)
+	flags.StringVar(&sqlFile, "db", "", "database file to read, required")
+	flags.StringVar(&outFile, "outfile", "", "file to write to or -- for stdout, required")
+	flags.StringVar(&format, "format", "apkg", "output format, one of apkg, csv")
+	flags.StringVar(&wordList, "words", "", "file listing the words to export, one per line")
+	flags.IntVar(&top, "top", 0, "only export words among the given number of highest ranked words")
+	flags.StringVar(&rank, "rank", "references", "how to rank words for -top, one of references, score")
+	flags.StringVar(&deck, "deck", "", "name of the deck, defaults to the name of the dictionary")
+	flags.Parse(argv)
+
+	if sqlFile == "" || outFile == "" || (format != "apkg" && format != "csv") || (rank != "references" && rank != "score") {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	db, err := wikidictdb.Open(sqlFile)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if deck == "" {
+		if deck, err = ankiDeckName(db); err != nil {
+			return err
+		}
+	}
+
+	ranking := db.MostReferenced
+
+	if rank == "score" {
+		ranking = db.HighestScored
+	}
+
+	words, err := selectAnkiWords(db, wordList, ranking, top)
+	if err != nil {
+		return err
+	}
+
+	var dst ankiDeckWriter
+
+	if format == "csv" {
+		dst, err = newAnkiCsvWriter(outFile, deck)
+	} else {
+		dst, err = newAnkiPackageWriter(outFile, deck)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	nwritten := 0
+
+	for _, word := range words {
+		entry, err := db.Lookup(word)
+
+		if err == wikidictdb.ErrNotFound {
+			fmt.Fprintf(os.Stderr, "%v: skipping %v, no such word\n", os.Args[0], word)
+			continue
+		}
+
+		if err != nil {
+			dst.Close()
+			return err
+		}
+
+		if entry.IsEmpty() {
+			continue
+		}
+
+		if err := dst.WriteCard(word, xmlEscape(word), formatAnkiBack(entry)); err != nil {
+			dst.Close()
+			return errors.Wrapf(err, "could not write card for word=%v", word)
+		}
+
+		nwritten += 1
+	}
+
+	if err := dst.Close(); err != nil {
+		return errors.Wrap(err, "could not finish writing deck")
+	}
+
+	fmt.Fprintf(os.Stderr, "%v: done exporting %v cards\n", os.Args[0], nwritten)
+	return nil
+}
+
+// Return the default name of decks exported from db, e.g.
+// "Wiktionary (English)".
+func ankiDeckName(db *wikidictdb.Database) (string, error) {
+	meta, err := db.Meta()
+	if err != nil {
+		return "", errors.Wrap(err, "could not read meta data")
+	}
+
+	name := meta["SourceSiteName"]
+
+	if name == "" {
+		name = "Wiktionary"
+	}
+
+	if languages := meta["Languages"]; languages != "" {
+		name += fmt.Sprintf(" (%v)", strings.ReplaceAll(languages, ",", ", "))
+	}
+
+	return name, nil
+}
+
+// Return the words to export. With a word list, these are the words in
+// the list in their given order; with top, only those among the top words
+// according to ranking. Without a word list, it is the top words in order
+// of rank. Without either, it is all words.
+func selectAnkiWords(db *wikidictdb.Database, wordList string, ranking func(limit, offset int) ([]wikidictdb.Word, error), top int) ([]string, error) {
+	var ranked []string
+
+	if top > 0 {
+		highestRanked, err := ranking(top, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, word := range highestRanked {
+			ranked = append(ranked, word.Word)
+		}
+	}
+
+	if wordList == "" && top > 0 {
+		return ranked, nil
+	}
+
+	if wordList == "" {
+		var all []string
+
+		err := db.ForEachWord(func(word wikidictdb.Word) bool {
+			all = append(all, word.Word)
+			return true
+		})
+
+		return all, err
+	}
+
+	contents, err := ioutil.ReadFile(wordList)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read file %v", wordList)
+	}
+
+	inRank := make(map[string]bool)
+
+	for _, word := range ranked {
+		inRank[word] = true
+	}
+
+	var selected []string
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		word := strings.TrimSpace(line)
+
+		if word == "" || (top > 0 && !inRank[word]) {
+			continue
+		}
+
+		selected = append(selected, word)
+	}
+
+	return selected, nil
+}
+
+// Return the back of the card for entry in HTML. Pronunciations come
+// first, followed by the definitions grouped by part of speech.
+func formatAnkiBack(entry *wikidictools.DictionaryEntry) string {
+	var back strings.Builder
+
+	if len(entry.Pronunciations) > 0 {
+		fmt.Fprintf(&back, "<div class=\"pron\">%v</div>", xmlEscape(strings.Join(entry.Pronunciations, ", ")))
+	}
+
+	entry.ForEachPartOfSpeech(func(partOfSpeech string, definitions []string) bool {
+		fmt.Fprintf(&back, "<div class=\"pos\">%v</div><ol>", partOfSpeech)
+
+		for _, definition := range definitions {
+			fmt.Fprintf(&back, "<li>%v</li>", formatHtmlDefinition(definition, func(target, text string) string {
+				return text
+			}))
+		}
+
+		back.WriteString("</ol>")
+		return true
+	})
+
+	return back.String()
+}
+
+// Return an ID for the deck or note type called name. Anki uses creation
+// times in milliseconds as IDs; hashing the name gets us numbers of the
+// same size that stay the same between exports, so that importing a deck
+// again updates it.
+func ankiId(name string) int64 {
+	hash := fnv.New64a()
+	io.WriteString(hash, name)
+	return int64(hash.Sum64() >> 23)
+}
+
+// Writes a text file with one card per line that the import dialog of
+// Anki reads without further configuration.
+type ankiCsvWriter struct {
+	file io.WriteCloser
+	out  *bufio.Writer
+	csv  *csv.Writer
+}
+
+func newAnkiCsvWriter(outFile, deck string) (ankiDeckWriter, error) {
+	file, err := OpenOutputFile(outFile)
+	if err != nil {
+		return nil, err
+	}
+
+	created := &ankiCsvWriter{
+		file: file,
+		out:  bufio.NewWriter(file),
+	}
+
+	created.csv = csv.NewWriter(created.out)
+
+	// Anki 2.1.55 and later read these headers. Older versions ask the
+	// user instead.
+
+	fmt.Fprintf(created.out, "#separator:Comma\n")
+	fmt.Fprintf(created.out, "#html:true\n")
+	fmt.Fprintf(created.out, "#notetype:Basic\n")
+	fmt.Fprintf(created.out, "#deck:%v\n", deck)
+	fmt.Fprintf(created.out, "#columns:Front,Back\n")
+
+	return created, nil
+}
+
+func (aw *ankiCsvWriter) WriteCard(word, front, back string) error {
+	return aw.csv.Write([]string{front, back})
+}
+
+func (aw *ankiCsvWriter) Close() error {
+	aw.csv.Flush()
+
+	if err := aw.csv.Error(); err != nil {
+		aw.file.Close()
+		return errors.Wrap(err, "could not flush output")
+	}
+
+	if err := aw.out.Flush(); err != nil {
+		aw.file.Close()
+		return errors.Wrap(err, "could not flush output")
+	}
+
+	return aw.file.Close()
+}
+
+// Writes an Anki package. A package is a zip archive of an SQLite
+// database with the collection of notes and cards and a manifest of media
+// files, which for us is always empty. The collection is built in a
+// temporary file and archived at Close.
+type ankiPackageWriter struct {
+	outFile    string
+	collection string
+
+	db *sql.DB
+	tx *sql.Tx
+
+	deckId  int64
+	modelId int64
+	deck    string
+
+	// Time of the export in milliseconds. Notes and cards get IDs
+	// counting up from here.
+	now    int64
+	ncards int64
+}
+
+func newAnkiPackageWriter(outFile, deck string) (ankiDeckWriter, error) {
+	tmp, err := ioutil.TempFile("", "wdictosqlite-*.anki2")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create temporary collection")
+	}
+
+	tmp.Close()
+
+	db, err := sql.Open("sqlite3", tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, errors.Wrap(err, "could not open temporary collection")
+	}
+
+	created := &ankiPackageWriter{
+		outFile:    outFile,
+		collection: tmp.Name(),
+		db:         db,
+		deckId:     ankiId(deck),
+		modelId:    ankiId(ANKI_MODEL_NAME),
+		deck:       deck,
+		now:        time.Now().UnixNano() / int64(time.Millisecond),
+	}
+
+	if err := created.createCollection(); err != nil {
+		created.discard()
+		return nil, err
+	}
+
+	if created.tx, err = db.Begin(); err != nil {
+		created.discard()
+		return nil, errors.Wrap(err, "could not begin transaction")
+	}
+
+	return created, nil
+}
+
+// Create the tables of the collection and its single row of settings
+// with our deck and note type.
+func (aw *ankiPackageWriter) createCollection() error {
+	if _, err := aw.db.Exec(ANKI_SCHEMA); err != nil {
+		return errors.Wrap(err, "could not create collection")
+	}
+
+	mod := aw.now / 1000
+
+	conf := map[string]any{
+		"activeDecks":   []int64{aw.deckId},
+		"curDeck":       aw.deckId,
+		"newSpread":     0,
+		"collapseTime":  1200,
+		"timeLim":       0,
+		"estTimes":      true,
+		"dueCounts":     true,
+		"curModel":      aw.modelId,
+		"nextPos":       1,
+		"sortType":      "noteFld",
+		"sortBackwards": false,
+		"addToCur":      true,
+	}
+
+	field := func(name string, ord int) map[string]any {
+		return map[string]any{
+			"name": name, "ord": ord, "sticky": false, "rtl": false,
+			"font": "Arial", "size": 20, "media": []string{},
+		}
+	}
+
+	models := map[string]any{
+		strconv.FormatInt(aw.modelId, 10): map[string]any{
+			"id":    aw.modelId,
+			"name":  ANKI_MODEL_NAME,
+			"type":  0,
+			"mod":   mod,
+			"usn":   -1,
+			"sortf": 0,
+			"did":   aw.deckId,
+			"tmpls": []map[string]any{{
+				"name":  "Card 1",
+				"ord":   0,
+				"qfmt":  "{{Front}}",
+				"afmt":  "{{FrontSide}}\n\n<hr id=answer>\n\n{{Back}}",
+				"did":   nil,
+				"bqfmt": "",
+				"bafmt": "",
+			}},
+			"flds":      []map[string]any{field("Front", 0), field("Back", 1)},
+			"css":       ANKI_CSS,
+			"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+			"latexPost": "\\end{document}",
+			"tags":      []string{},
+			"vers":      []string{},
+			"req":       []any{[]any{0, "all", []int{0}}},
+		},
+	}
+
+	deck := func(id int64, name string) map[string]any {
+		return map[string]any{
+			"id": id, "name": name, "desc": "", "mod": mod, "usn": -1,
+			"conf": 1, "dyn": 0, "collapsed": false, "extendNew": 10,
+			"extendRev": 50, "newToday": []int{0, 0}, "revToday": []int{0, 0},
+			"lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+
+	// The default deck must always exist.
+
+	decks := map[string]any{
+		"1": deck(1, "Default"),
+	}
+
+	decks[strconv.FormatInt(aw.deckId, 10)] = deck(aw.deckId, aw.deck)
+
+	deckConfigs := map[string]any{
+		"1": map[string]any{
+			"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60,
+			"autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+			"new": map[string]any{
+				"bury": true, "delays": []int{1, 10}, "initialFactor": 2500,
+				"ints": []int{1, 4, 7}, "order": 1, "perDay": 20, "separate": true,
+			},
+			"lapse": map[string]any{
+				"delays": []int{10}, "leechAction": 0, "leechFails": 8,
+				"minInt": 1, "mult": 0,
+			},
+			"rev": map[string]any{
+				"bury": true, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1,
+				"maxIvl": 36500, "minSpace": 1, "perDay": 200,
+			},
+		},
+	}
+
+	var encoded []string
+
+	for _, value := range []any{conf, models, decks, deckConfigs} {
+		bs, err := json.Marshal(value)
+		if err != nil {
+			return errors.Wrap(err, "could not encode collection settings")
+		}
+
+		encoded = append(encoded, string(bs))
+	}
+
+	sql := `
+		INSERT INTO col(id, crt, mod, scm, ver, dty, usn, ls, conf, models, decks, dconf, tags)
+		VALUES(1, $1, $2, $2, 11, 0, 0, 0, $3, $4, $5, $6, '{}');`
+
+	if _, err := aw.db.Exec(sql, mod, aw.now, encoded[0], encoded[1], encoded[2], encoded[3]); err != nil {
+		return errors.Wrap(err, "could not insert collection settings")
+	}
+
+	return nil
+}
+
+func (aw *ankiPackageWriter) WriteCard(word, front, back string) error {
+	aw.ncards += 1
+	id := aw.now + aw.ncards
+
+	// The GUID identifies the note when the deck is imported again. The
+	// checksum is taken over the sort field stripped of HTML, which is
+	// just the word.
+
+	guid := strconv.FormatInt(ankiId(aw.deck+"\x00"+word), 36)
+
+	digest := sha1.Sum([]byte(word))
+	checksum := binary.BigEndian.Uint32(digest[:4])
+
+	sql := `
+		INSERT INTO notes(id, guid, mid, mod, usn, tags, flds, sfld, csum, flags, data)
+		VALUES($1, $2, $3, $4, -1, '', $5, $6, $7, 0, '');`
+
+	if _, err := aw.tx.Exec(sql, id, guid, aw.modelId, aw.now/1000, front+"\x1f"+back, front, checksum); err != nil {
+		return errors.Wrap(err, "could not insert note")
+	}
+
+	// New cards are shown in order of their due number.
+
+	sql = `
+		INSERT INTO cards(id, nid, did, ord, mod, usn, type, queue, due, ivl, factor, reps, lapses, left, odue, odid, flags, data)
+		VALUES($1, $1, $2, 0, $3, -1, 0, 0, $4, 0, 0, 0, 0, 0, 0, 0, 0, '');`
+
+	if _, err := aw.tx.Exec(sql, id, aw.deckId, aw.now/1000, aw.ncards); err != nil {
+		return errors.Wrap(err, "could not insert card")
+	}
+
+	return nil
+}
+
+func (aw *ankiPackageWriter) Close() error {
+	defer aw.discard()
+
+	if err := aw.tx.Commit(); err != nil {
+		return errors.Wrap(err, "could not commit collection")
+	}
+
+	if err := aw.db.Close(); err != nil {
+		return errors.Wrap(err, "could not close collection")
+	}
+
+	file, err := OpenOutputFile(aw.outFile)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(file)
+
+	if err := aw.archiveFile(archive, "collection.anki2"); err != nil {
+		file.Close()
+		return err
+	}
+
+	media, err := archive.Create("media")
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "could not write media manifest")
+	}
+
+	io.WriteString(media, "{}")
+
+	if err := archive.Close(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "could not finish package")
+	}
+
+	return file.Close()
+}
+
+// Copy the collection into archive under name.
+func (aw *ankiPackageWriter) archiveFile(archive *zip.Writer, name string) error {
+	collection, err := os.Open(aw.collection)
+	if err != nil {
+		return errors.Wrap(err, "could not open temporary collection")
+	}
+
+	defer collection.Close()
+
+	dst, err := archive.Create(name)
+	if err != nil {
+		return errors.Wrap(err, "could not add collection to package")
+	}
+
+	if _, err := io.Copy(dst, collection); err != nil {
+		return errors.Wrap(err, "could not add collection to package")
+	}
+
+	return nil
+}
+
+// Remove the temporary collection. Safe to call more than once.
+func (aw *ankiPackageWriter) discard() {
+	aw.db.Close()
+	os.Remove(aw.collection)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Matches [[links]] in definitions that were escaped for HTML.
+var _HTML_LINK_PATTERN = regexp.MustCompile(`\[\[(.*?)\]\]`)
+
+// Style sheet written next to the dictionary source.
+const APPLE_DICTIONARY_CSS = `@charset "UTF-8";
+@namespace d url(http://www.apple.com/DTDs/DictionaryService-1.0.rng);
+
+d|entry h1 { font-size: 150%; }
+d|entry .pron { color: gray; }
+d|entry .pos { font-style: italic; margin-bottom: 0; }
+d|entry .etym { font-size: 90%; }
+`
+
+// ID of the entry that holds the front matter of the dictionary.
+const APPLE_FRONT_MATTER_ID = "front_back_matter"
+
+// Writes the sources of a dictionary for the Dictionary Development Kit
+// that comes with Xcode. Given -outfile NAME, it creates NAME.xml,
+// NAME.css and NAME.plist; these are what the build_dict.sh script of the
+// kit expects.
+type appleDictionaryWriter struct {
+	file *os.File
+	out  *bufio.Writer
+}
+
+func NewAppleDictionaryWriter(args *Arguments, siteInfo wikidictools.SiteInfo) (EntryWriter, error) {
+	copying, err := ReadCopying(args)
+	if err != nil {
+		return nil, err
+	}
+
+	title := DictionaryTitle(siteInfo)
+
+	// The kit only shows the front matter if the property list names the
+	// entry it is in.
+
+	frontMatter := ""
+
+	if copying != "" {
+		frontMatter = fmt.Sprintf("\t<key>DCSDictionaryFrontMatterReferenceID</key>\n\t<string>%v</string>\n", APPLE_FRONT_MATTER_ID)
+	}
+
+	plist := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleDevelopmentRegion</key>
+	<string>%v</string>
+	<key>CFBundleIdentifier</key>
+	<string>org.wiktionary.%v</string>
+	<key>CFBundleName</key>
+	<string>%v</string>
+	<key>CFBundleShortVersionString</key>
+	<string>%v</string>
+	<key>DCSDictionaryCopyright</key>
+	<string>%v</string>
+	<key>DCSDictionaryManufacturerName</key>
+	<string>wdictosqlite</string>
+%v</dict>
+</plist>
+`,
+		LANGUAGE_CODE,
+		xmlEscape(siteInfo.DbName),
+		xmlEscape(title),
+		xmlEscape(args.CreatedOn),
+		xmlEscape(strings.TrimSpace(copying)),
+		frontMatter,
+	)
+
+	if err := ioutil.WriteFile(args.OutFile+".plist", []byte(plist), 0644); err != nil {
+		return nil, errors.Wrap(err, "could not write property list")
+	}
+
+	if err := ioutil.WriteFile(args.OutFile+".css", []byte(APPLE_DICTIONARY_CSS), 0644); err != nil {
+		return nil, errors.Wrap(err, "could not write style sheet")
+	}
+
+	file, err := os.Create(args.OutFile + ".xml")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create dictionary source")
+	}
+
+	created := &appleDictionaryWriter{
+		file: file,
+		out:  bufio.NewWriter(file),
+	}
+
+	fmt.Fprintf(created.out, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(created.out, "<d:dictionary xmlns=\"http://www.w3.org/1999/xhtml\" xmlns:d=\"http://www.apple.com/DTDs/DictionaryService-1.0.rng\">\n")
+
+	// The copyright goes into the front matter of the dictionary.
+
+	if copying != "" {
+		fmt.Fprintf(created.out, "<d:entry id=\"%v\" d:title=\"%v\">\n", APPLE_FRONT_MATTER_ID, xmlEscape(title))
+		fmt.Fprintf(created.out, "<h1>%v</h1>\n", xmlEscape(title))
+
+		for _, paragraph := range strings.Split(strings.TrimSpace(copying), "\n\n") {
+			fmt.Fprintf(created.out, "<p>%v</p>\n", xmlEscape(paragraph))
+		}
+
+		fmt.Fprintf(created.out, "</d:entry>\n")
+	}
+
+	return created, nil
+}
+
+func (aw *appleDictionaryWriter) WriteEntry(entry *wikidictools.DictionaryEntry) error {
+	if entry.IsEmpty() {
+		return nil
+	}
+
+	out := aw.out
+
+	fmt.Fprintf(out, "<d:entry id=\"%v\" d:title=\"%v\">\n", xmlId(entry.Word), xmlEscape(entry.Word))
+
+	// Each index entry makes the article show up when looking up that
+	// word.
+
+	headwords := []string{entry.Word}
+	headwords = append(headwords, entry.AlternativeForms...)
+	headwords = append(headwords, entry.Inflections...)
+
+	for _, headword := range headwords {
+		fmt.Fprintf(out, "<d:index d:value=\"%v\" d:title=\"%v\"/>\n", xmlEscape(headword), xmlEscape(entry.Word))
+	}
+
+	fmt.Fprintf(out, "<h1>%v</h1>\n", xmlEscape(entry.Word))
+
+	if len(entry.Pronunciations) > 0 {
+		fmt.Fprintf(out, "<p class=\"pron\" d:pr=\"IPA\">%v</p>\n", xmlEscape(strings.Join(entry.Pronunciations, ", ")))
+	}
+
+	entry.ForEachPartOfSpeech(func(partOfSpeech string, definitions []string) bool {
+		fmt.Fprintf(out, "<p class=\"pos\">%v</p>\n", partOfSpeech)
+		fmt.Fprintf(out, "<ol>\n")
+
+		for _, definition := range definitions {
+			fmt.Fprintf(out, "<li>%v</li>\n", formatHtmlDefinition(definition, func(target, text string) string {
+				return fmt.Sprintf("<a href=\"%v\">%v</a>", appleLink(target), text)
+			}))
+		}
+
+		fmt.Fprintf(out, "</ol>\n")
+		return true
+	})
+
+	for _, etymology := range entry.Etymologies {
+		fmt.Fprintf(out, "<p class=\"etym\">%v</p>\n", xmlEscape(etymology))
+	}
+
+	fmt.Fprintf(out, "</d:entry>\n")
+	return nil
+}
+
+func (aw *appleDictionaryWriter) Close() error {
+	fmt.Fprintf(aw.out, "</d:dictionary>\n")
+
+	if err := aw.out.Flush(); err != nil {
+		aw.file.Close()
+		return errors.Wrap(err, "could not flush dictionary source")
+	}
+
+	return aw.file.Close()
+}
+
+// Return the link to the entry of target, escaped for use in an attribute.
+// Like all links from formatHtmlDefinition, target is XML-escaped already.
+func appleLink(target string) string {
+	return xmlEscape("x-dictionary:d:" + url.PathEscape(html.UnescapeString(target)))
+}
+
+// Return definition escaped for use in XHTML. Each [[link]] is replaced
+// by the result of link, which gets the escaped target and text of the
+// link.
+func formatHtmlDefinition(definition string, link func(target, text string) string) string {
+	return _HTML_LINK_PATTERN.ReplaceAllStringFunc(xmlEscape(definition), func(match string) string {
+		inner := _HTML_LINK_PATTERN.FindStringSubmatch(match)[1]
+		target, text, ok := strings.Cut(inner, "|")
+
+		if !ok {
+			text = target
+		}
+
+		return link(target, text)
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kissen/wikidictools/wikidictdb"
+	"github.com/pkg/errors"
+)
+
+// Print the most referenced words of a database that start with the given
+// prefix, ignoring case and diacritics. Each line has the word and its
+// number of references, separated by a tab.
+func RunComplete(argv []string) error {
+	var (
+		sqlFile string
+		outFile string
+		prefix  string
+		limit   int
+	)
+
+	flags := flag.NewFlagSet(os.Args[0]+" complete", flag.ExitOnError)
+	flags.StringVar(&sqlFile, "db", "", "database file to read, required")
+	flags.StringVar(&outFile, "outfile", "--", "file to write to or -- for stdout")
+	flags.StringVar(&prefix, "prefix", "", "prefix to complete")
+	flags.IntVar(&limit, "limit", 10, "maximum number of words to print")
+	flags.Parse(argv)
+
+	if sqlFile == "" || limit < 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	db, err := wikidictdb.Open(sqlFile)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	words, err := db.Complete(prefix, limit)
+	if err != nil {
+		return err
+	}
+
+	file, err := OpenOutputFile(outFile)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(file)
+
+	for _, word := range words {
+		fmt.Fprintf(out, "%v\t%v\n", word.Word, word.NReferences)
+	}
+
+	if err := out.Flush(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "could not flush output")
+	}
+
+	return file.Close()
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"os"
+	"strings"
 
 	"github.com/kissen/wikidictools/wikidictools"
 	"github.com/pkg/errors"
@@ -25,86 +26,265 @@ func CreateEmptyFileAt(filename string) error {
 	return nil
 }
 
+// Create all tables at the latest schema version in the empty database db.
 func CreateTablesWith(db *sql.DB) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return errors.Wrap(err, "could not start transaction")
+	if _, _, err := MigrateDatabase(db); err != nil {
+		return errors.Wrap(err, "could not set up schema")
 	}
 
-	if err := createWordTable(tx); err != nil {
-		return rollbackBecauseOf(err, tx)
+	return nil
+}
+
+func InsertDictionaryEntry(tx *sql.Tx, entry *wikidictools.DictionaryEntry) error {
+	// First we add the word itself.
+
+	wordId, err := insertWord(tx, entry)
+	if err != nil {
+		return errors.Wrapf(err, "could not insert word=%v", entry.Word)
 	}
 
-	if err := createWordIndex(tx); err != nil {
-		return rollbackBecauseOf(err, tx)
+	if err := insertDeleteVariants(tx, wordId, entry.Headword()); err != nil {
+		return errors.Wrapf(err, "could not insert delete variants for word=%v", entry.Word)
 	}
 
-	if err := createDefintionTable(tx); err != nil {
-		return rollbackBecauseOf(err, tx)
+	// Now we add the individual defintions.
+
+	var insertError error
+
+	entry.ForEachPartOfSpeech(func(partOfSpeech string, definitions []string) bool {
+		for _, definition := range definitions {
+			if insertError = insertDefintion(tx, wordId, partOfSpeech, definition); insertError != nil {
+				return false
+			}
+		}
+
+		return true // keep iterating if no error occured
+	})
+
+	if insertError != nil {
+		return errors.Wrapf(insertError, "insertin defintion for word=%v failed", entry.Word)
 	}
 
-	if err := createMetaTable(tx); err != nil {
-		return rollbackBecauseOf(err, tx)
+	for position, pronunciation := range entry.Pronunciations {
+		if err := insertPronunciation(tx, wordId, position, pronunciation); err != nil {
+			return errors.Wrapf(err, "could not insert pronunciation for word=%v", entry.Word)
+		}
 	}
 
-	if err := createDefinitionsIndex(tx); err != nil {
-		return rollbackBecauseOf(err, tx)
+	for position, inflection := range entry.Inflections {
+		if err := insertInflection(tx, wordId, position, inflection); err != nil {
+			return errors.Wrapf(err, "could not insert inflection for word=%v", entry.Word)
+		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return errors.Wrap(err, "commit failed")
+	for _, target := range entry.Links {
+		if err := insertLink(tx, wordId, target); err != nil {
+			return errors.Wrapf(err, "could not insert link for word=%v", entry.Word)
+		}
 	}
 
-	return nil
-}
+	for _, label := range entry.Labels {
+		if err := insertLabel(tx, wordId, label); err != nil {
+			return errors.Wrapf(err, "could not insert label for word=%v", entry.Word)
+		}
+	}
 
-func InsertDictionaryEntry(tx *sql.Tx, entry *wikidictools.DictionaryEntry) error {
-	// First we add the word itself.
+	// Reconstructed words come with their proto-language and descendants.
 
-	wordId, err := insertWord(tx, entry.Word, entry.Revision)
-	if err != nil {
-		return errors.Wrapf(err, "could not insert word=%v", entry.Word)
+	if entry.Reconstruction != nil {
+		if err := insertReconstruction(tx, wordId, entry.Reconstruction); err != nil {
+			return errors.Wrapf(err, "could not insert reconstruction for word=%v", entry.Word)
+		}
 	}
 
-	// Now we add the individual defintions.
+	// We are done here! Success!
 
-	var insertError error
+	return nil
+}
 
-	entry.ForEachDefintion(func(definition string) bool {
-		insertError = insertDefintion(tx, wordId, definition)
-		return insertError == nil // keep iterating if no error occured
-	})
+// Insert all synonym sets of a thesaurus page. The sets are not yet linked
+// to the words table; see LinkThesaurus.
+func InsertThesaurus(tx *sql.Tx, thesaurus *wikidictools.Thesaurus) error {
+	for _, set := range thesaurus.Sets {
+		setId, err := insertSynonymSet(tx, thesaurus.Headword, &set)
+		if err != nil {
+			return errors.Wrapf(err, "could not insert synonym set for headword=%v", thesaurus.Headword)
+		}
+
+		for _, word := range set.Words {
+			if err := insertSynonym(tx, setId, word); err != nil {
+				return errors.Wrapf(err, "could not insert synonym=%v", word)
+			}
+		}
+	}
 
-	if insertError != nil {
-		return errors.Wrapf(err, "insertin defintion for word=%v failed", entry.Word)
+	return nil
+}
+
+// Point synonym sets and their members to the matching rows in the words
+// table. Only call this once all words have been inserted.
+func LinkThesaurus(db Preparer) error {
+	statements := []string{
+		`UPDATE synonym_sets SET headword_id = (SELECT id FROM words WHERE words.word = synonym_sets.headword);`,
+		`UPDATE synonyms SET word_id = (SELECT id FROM words WHERE words.word = synonyms.word);`,
 	}
 
-	// We are done here! Success!
+	for _, sql := range statements {
+		if err := execute(db, sql); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// Fill the empty full-text index with the definitions of all words. Only
+// call this once all words have been inserted. As the index stores no
+// content, it cannot be updated later on.
+func BuildFullTextIndex(db Preparer) error {
+	sql := `
+		INSERT INTO words_fts(docid, definitions)
+		SELECT word_id, group_concat(definition, ' ') FROM definitions GROUP BY word_id;`
+
+	return execute(db, sql)
+}
+
 func SetNumberOfReferencesOn(tx *sql.Tx, word string, nreferences int64) error {
 	sql := `UPDATE words SET nreferences = $1 WHERE word = $2;`
 	return execute(tx, sql, nreferences, word)
 }
 
-// Insert key/value pair into meta table.
-func InsertMeta(db Preparer, key, value string) error {
-	sql := `INSERT INTO meta(key, value) VALUES($1, $2)`
+// Set key to value in the meta table, replacing any previous value.
+func SetMeta(db Preparer, key, value string) error {
+	sql := `INSERT OR REPLACE INTO meta(key, value) VALUES($1, $2)`
 	return execute(db, sql, key, value)
 }
 
-// Insert word into the database. Returns the assigned id.
-func insertWord(db Preparer, word string, revision uint64) (int64, error) {
-	sql := `INSERT INTO words(word, revision) VALUES($1, $2);`
-	return insert(db, sql, word, revision)
+// Insert namespace into the namespaces table.
+func InsertNamespace(db Preparer, namespace wikidictools.Namespace) error {
+	sql := `INSERT OR REPLACE INTO namespaces(id, name) VALUES($1, $2);`
+	return execute(db, sql, namespace.Key, namespace.Name)
+}
+
+// Insert the word of entry into the database together with the keys
+// derived from its headword. Returns the assigned id.
+func insertWord(db Preparer, entry *wikidictools.DictionaryEntry) (int64, error) {
+	sql := `
+		INSERT INTO words(word, key, revision, namespace, proper_noun, letters, soundex, metaphone, metaphone_alt, ipa_key, folded)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`
+
+	headword := entry.Headword()
+	metaphone, metaphoneAlt := wikidictools.DoubleMetaphone(headword)
+
+	// Words are keyed by their first pronunciation.
+
+	ipaKey := ""
+
+	if len(entry.Pronunciations) > 0 {
+		ipaKey = wikidictools.IpaKey(entry.Pronunciations[0])
+	}
+
+	return insert(
+		db, sql, entry.Word, nullIfEmpty(entry.Key), entry.Revision, entry.Namespace, entry.ProperNoun,
+		nullIfEmpty(wikidictools.SortedLetters(headword)),
+		nullIfEmpty(wikidictools.Soundex(headword)),
+		nullIfEmpty(metaphone), nullIfEmpty(metaphoneAlt), nullIfEmpty(ipaKey),
+		nullIfEmpty(wikidictools.FoldWord(headword)),
+	)
+}
+
+// Insert the variants of word with characters deleted that make up the
+// deletion index for fuzzy lookups. See wikidictools.DeleteVariants.
+func insertDeleteVariants(db Preparer, wordId int64, word string) error {
+	variants := wikidictools.DeleteVariants(word, wikidictools.FUZZY_MAX_DISTANCE, wikidictools.FUZZY_PREFIX_LENGTH)
+
+	// Words have dozens of variants, so we insert them all at once.
+
+	placeholders := strings.TrimSuffix(strings.Repeat("(?, ?), ", len(variants)), ", ")
+	sql := `INSERT INTO delete_variants(variant, word_id) VALUES ` + placeholders + `;`
+
+	args := make([]any, 0, 2*len(variants))
+
+	for _, variant := range variants {
+		args = append(args, variant, wordId)
+	}
+
+	return execute(db, sql, args...)
 }
 
 // Insert defintion in the database.
-func insertDefintion(db Preparer, wordId int64, defintion string) error {
-	sql := `INSERT INTO definitions(word_id, definition) VALUES($1, $2);`
-	return execute(db, sql, wordId, defintion)
+func insertDefintion(db Preparer, wordId int64, partOfSpeech string, defintion string) error {
+	sql := `INSERT INTO definitions(word_id, pos, definition) VALUES($1, $2, $3);`
+	return execute(db, sql, wordId, partOfSpeech, defintion)
+}
+
+// Insert pronunciation of word wordId. Position is the index of the
+// pronunciation on the page.
+func insertPronunciation(db Preparer, wordId int64, position int, pronunciation string) error {
+	sql := `INSERT INTO pronunciations(word_id, position, pronunciation) VALUES($1, $2, $3);`
+	return execute(db, sql, wordId, position, pronunciation)
+}
+
+// Insert inflected form of word wordId. Position is the index of the
+// form in the headword template.
+func insertInflection(db Preparer, wordId int64, position int, inflection string) error {
+	sql := `INSERT INTO inflections(word_id, position, inflection) VALUES($1, $2, $3);`
+	return execute(db, sql, wordId, position, inflection)
+}
+
+// Insert link from the definitions of word wordId to target. Targets need
+// not be words of the database.
+func insertLink(db Preparer, wordId int64, target string) error {
+	sql := `INSERT INTO links(word_id, target) VALUES($1, $2);`
+	return execute(db, sql, wordId, target)
+}
+
+// Insert label that applies to all definitions of word wordId.
+func insertLabel(db Preparer, wordId int64, label string) error {
+	sql := `INSERT INTO labels(word_id, label) VALUES($1, $2);`
+	return execute(db, sql, wordId, label)
+}
+
+// Insert reconstruction of word wordId and all of its descendants.
+func insertReconstruction(db Preparer, wordId int64, reconstruction *wikidictools.Reconstruction) error {
+	sql := `INSERT INTO reconstructions(word_id, language, form) VALUES($1, $2, $3);`
+
+	if err := execute(db, sql, wordId, reconstruction.Language, reconstruction.Form); err != nil {
+		return err
+	}
+
+	for position, descendant := range reconstruction.Descendants {
+		if err := insertDescendant(db, wordId, position, &descendant); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Insert descendant of reconstructed word wordId. Position is the index
+// of the descendant on the page; it is needed to rebuild the tree.
+func insertDescendant(db Preparer, wordId int64, position int, descendant *wikidictools.Descendant) error {
+	sql := `
+		INSERT INTO descendants(word_id, position, depth, language, descendant, tree)
+		VALUES($1, $2, $3, $4, $5, $6);`
+
+	return execute(db, sql, wordId, position, descendant.Depth, descendant.Language, descendant.Word, descendant.Tree)
+}
+
+// Insert synonym set without its words. Returns the assigned id.
+func insertSynonymSet(db Preparer, headword string, set *wikidictools.SynonymSet) (int64, error) {
+	sql := `
+		INSERT INTO synonym_sets(headword, pos, sense, gloss, relation)
+		VALUES($1, $2, $3, $4, $5);`
+
+	return insert(db, sql, headword, set.PartOfSpeech, set.Sense, set.Gloss, set.Relation)
+}
+
+// Insert word as member of synonym set setId.
+func insertSynonym(db Preparer, setId int64, word string) error {
+	sql := `INSERT INTO synonyms(set_id, word) VALUES($1, $2);`
+	return execute(db, sql, setId, word)
 }
 
 func createWordTable(db Preparer) error {
@@ -140,6 +320,250 @@ func createMetaTable(db Preparer) error {
 	return execute(db, sql)
 }
 
+func createNamespaceTable(db Preparer) error {
+	sql := `
+		CREATE TABLE namespaces (
+			id INTEGER NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL
+		);`
+
+	return execute(db, sql)
+}
+
+func createReconstructionTable(db Preparer) error {
+	sql := `
+		CREATE TABLE reconstructions (
+			word_id INTEGER NOT NULL PRIMARY KEY,
+			language TEXT NOT NULL,
+			form TEXT NOT NULL,
+			FOREIGN KEY(word_id) REFERENCES words(id)
+		);`
+
+	return execute(db, sql)
+}
+
+func createDescendantTable(db Preparer) error {
+	sql := `
+		CREATE TABLE descendants (
+			word_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			depth INTEGER NOT NULL,
+			language TEXT NOT NULL,
+			descendant TEXT NOT NULL,
+			tree BOOLEAN NOT NULL,
+			FOREIGN KEY(word_id) REFERENCES reconstructions(word_id)
+		);`
+
+	return execute(db, sql)
+}
+
+func createDescendantIndices(db Preparer) error {
+	statements := []string{
+		`CREATE INDEX index_reconstruction_form ON reconstructions(form);`,
+		`CREATE INDEX index_word_id_to_descendant ON descendants(word_id, position);`,
+		`CREATE INDEX index_descendant ON descendants(descendant);`,
+	}
+
+	for _, sql := range statements {
+		if err := execute(db, sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createSynonymSetTable(db Preparer) error {
+	sql := `
+		CREATE TABLE synonym_sets (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			headword TEXT NOT NULL,
+			headword_id INTEGER,
+			pos TEXT NOT NULL,
+			sense TEXT NOT NULL,
+			gloss TEXT NOT NULL,
+			relation TEXT NOT NULL,
+			FOREIGN KEY(headword_id) REFERENCES words(id)
+		);`
+
+	return execute(db, sql)
+}
+
+func createSynonymTable(db Preparer) error {
+	sql := `
+		CREATE TABLE synonyms (
+			set_id INTEGER NOT NULL,
+			word TEXT NOT NULL,
+			word_id INTEGER,
+			FOREIGN KEY(set_id) REFERENCES synonym_sets(id),
+			FOREIGN KEY(word_id) REFERENCES words(id)
+		);`
+
+	return execute(db, sql)
+}
+
+func createThesaurusIndices(db Preparer) error {
+	statements := []string{
+		`CREATE INDEX index_synonym_set_headword ON synonym_sets(headword_id);`,
+		`CREATE INDEX index_synonym_set ON synonyms(set_id);`,
+		`CREATE INDEX index_synonym_word ON synonyms(word_id);`,
+	}
+
+	for _, sql := range statements {
+		if err := execute(db, sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Synonym sets are looked up by headword, which need not be a word of the
+// database.
+func createSynonymSetIndex(db Preparer) error {
+	sql := `CREATE INDEX index_synonym_set_headword_text ON synonym_sets(headword);`
+	return execute(db, sql)
+}
+
+func createPronunciationTable(db Preparer) error {
+	sql := `
+		CREATE TABLE pronunciations (
+			word_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			pronunciation TEXT NOT NULL,
+			FOREIGN KEY(word_id) REFERENCES words(id)
+		);`
+
+	return execute(db, sql)
+}
+
+func createPronunciationIndex(db Preparer) error {
+	sql := `CREATE INDEX index_word_id_to_pronunciation ON pronunciations(word_id, position);`
+	return execute(db, sql)
+}
+
+func createInflectionTable(db Preparer) error {
+	sql := `
+		CREATE TABLE inflections (
+			word_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			inflection TEXT NOT NULL,
+			FOREIGN KEY(word_id) REFERENCES words(id)
+		);`
+
+	return execute(db, sql)
+}
+
+func createLabelTable(db Preparer) error {
+	sql := `
+		CREATE TABLE labels (
+			word_id INTEGER NOT NULL,
+			label TEXT NOT NULL,
+			FOREIGN KEY(word_id) REFERENCES words(id)
+		);`
+
+	return execute(db, sql)
+}
+
+func createInflectionIndices(db Preparer) error {
+	statements := []string{
+		`CREATE INDEX index_word_id_to_inflection ON inflections(word_id, position);`,
+		`CREATE INDEX index_inflection_to_word_id ON inflections(inflection);`,
+		`CREATE INDEX index_word_id_to_label ON labels(word_id);`,
+	}
+
+	for _, sql := range statements {
+		if err := execute(db, sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createLinkTable(db Preparer) error {
+	sql := `
+		CREATE TABLE links (
+			word_id INTEGER NOT NULL,
+			target TEXT NOT NULL,
+			FOREIGN KEY(word_id) REFERENCES words(id)
+		);`
+
+	return execute(db, sql)
+}
+
+func createLinkIndex(db Preparer) error {
+	sql := `CREATE INDEX index_word_id_to_link ON links(word_id);`
+	return execute(db, sql)
+}
+
+func createLettersIndex(db Preparer) error {
+	sql := `CREATE INDEX index_words_letters ON words(letters);`
+	return execute(db, sql)
+}
+
+func createPhoneticIndices(db Preparer) error {
+	statements := []string{
+		`CREATE INDEX index_words_soundex ON words(soundex);`,
+		`CREATE INDEX index_words_metaphone ON words(metaphone);`,
+		`CREATE INDEX index_words_metaphone_alt ON words(metaphone_alt);`,
+		`CREATE INDEX index_words_ipa_key ON words(ipa_key);`,
+	}
+
+	for _, sql := range statements {
+		if err := execute(db, sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createKeyIndex(db Preparer) error {
+	sql := `CREATE INDEX index_words_key ON words(key);`
+	return execute(db, sql)
+}
+
+// Lists of the most referenced words go through this index.
+func createReferencesIndex(db Preparer) error {
+	sql := `CREATE INDEX index_words_nreferences ON words(nreferences DESC, word);`
+	return execute(db, sql)
+}
+
+func createScoreIndex(db Preparer) error {
+	sql := `CREATE INDEX index_words_score ON words(score);`
+	return execute(db, sql)
+}
+
+func createFoldedIndex(db Preparer) error {
+	sql := `CREATE INDEX index_words_folded ON words(folded);`
+	return execute(db, sql)
+}
+
+func createDeleteVariantTable(db Preparer) error {
+	sql := `
+		CREATE TABLE delete_variants (
+			variant TEXT NOT NULL,
+			word_id INTEGER NOT NULL,
+			FOREIGN KEY(word_id) REFERENCES words(id)
+		);`
+
+	return execute(db, sql)
+}
+
+func createDeleteVariantIndex(db Preparer) error {
+	sql := `CREATE INDEX index_delete_variant ON delete_variants(variant);`
+	return execute(db, sql)
+}
+
+// The full-text index has one document per word that contains all of
+// its definitions. The document ID is the ID of the word. It stores no
+// content of its own.
+func createFullTextTable(db Preparer) error {
+	sql := `CREATE VIRTUAL TABLE words_fts USING fts4(content="", definitions);`
+	return execute(db, sql)
+}
+
 func createWordIndex(db Preparer) error {
 	sql := `CREATE UNIQUE INDEX index_words ON words(word);`
 	return execute(db, sql)
@@ -163,6 +587,57 @@ func execute(db Preparer, sql string, args ...any) error {
 	return nil
 }
 
+// Run a query that returns a single string. Returns sql.ErrNoRows as-is
+// if the query returned no rows.
+func queryString(db Preparer, sql string, args ...any) (string, error) {
+	statement, err := db.Prepare(sql)
+	if err != nil {
+		return "", errors.Wrap(err, "could not prepare statement")
+	}
+
+	defer statement.Close()
+
+	var value string
+
+	if err := statement.QueryRow(args...).Scan(&value); err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// Return whether a table with the given name exists in the database.
+func hasTable(db Preparer, table string) (bool, error) {
+	query := `SELECT name FROM sqlite_master WHERE type = 'table' AND name = $1;`
+
+	switch _, err := queryString(db, query, table); err {
+	case nil:
+		return true, nil
+	case sql.ErrNoRows:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Run a query that returns a single integer.
+func queryInt(db Preparer, sql string, args ...any) (int64, error) {
+	statement, err := db.Prepare(sql)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not prepare statement")
+	}
+
+	defer statement.Close()
+
+	var value int64
+
+	if err := statement.QueryRow(args...).Scan(&value); err != nil {
+		return 0, errors.Wrap(err, "could not run query")
+	}
+
+	return value, nil
+}
+
 func insert(db Preparer, sql string, args ...any) (int64, error) {
 	statement, err := db.Prepare(sql)
 	if err != nil {
@@ -186,3 +661,9 @@ func rollbackBecauseOf(dbError error, tx *sql.Tx) error {
 
 	return dbError
 }
+
+// Return s as a nullable string that is NULL if s is empty. Used for keys
+// that cannot be computed for all words.
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Digits used by dictd to encode offsets and lengths in its index.
+const DICTD_BASE64_DIGITS = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// Writes a database for the dictd server. Given -outfile NAME, it creates
+// NAME.index and NAME.dict.dz.
+//
+// Just like with StarDict, articles are written as they come in and only
+// the index is kept in memory.
+type dictdWriter struct {
+	basePath string
+
+	dict   *os.File
+	out    *bufio.Writer
+	offset int64
+
+	index []dictdIndexEntry
+}
+
+// A single line of the index. Each headword, including alternative
+// forms, gets its own line.
+type dictdIndexEntry struct {
+	headword string
+	offset   int64
+	length   int64
+}
+
+func NewDictdWriter(args *Arguments, siteInfo wikidictools.SiteInfo) (EntryWriter, error) {
+	copying, err := ReadCopying(args)
+	if err != nil {
+		return nil, err
+	}
+
+	dict, err := os.Create(args.OutFile + ".dict")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create dictionary file")
+	}
+
+	created := &dictdWriter{
+		basePath: args.OutFile,
+		dict:     dict,
+		out:      bufio.NewWriter(dict),
+	}
+
+	// dictd reads information about the database from entries with special
+	// headwords. 00-database-utf8 only needs to exist.
+
+	info := fmt.Sprintf("Created on %v from the %v dump.", args.CreatedOn, siteInfo.DbName)
+
+	if copying != "" {
+		info = copying + "\n\n" + info
+	}
+
+	headers := []struct {
+		headword string
+		contents string
+	}{
+		{"00-database-short", DictionaryTitle(siteInfo)},
+		{"00-database-info", info},
+		{"00-database-url", siteInfo.Base},
+		{"00-database-utf8", ""},
+		{"00-database-allchars", ""},
+	}
+
+	for _, header := range headers {
+		if err := created.writeArticle([]string{header.headword}, header.headword+"\n"+header.contents+"\n"); err != nil {
+			dict.Close()
+			return nil, err
+		}
+	}
+
+	return created, nil
+}
+
+func (dw *dictdWriter) WriteEntry(entry *wikidictools.DictionaryEntry) error {
+	if entry.IsEmpty() {
+		return nil
+	}
+
+	// Like articles created with dictfmt, the article starts with the
+	// headword and continues with indented text.
+
+	var article strings.Builder
+
+	article.WriteString(entry.Word)
+	article.WriteString("\n\n")
+
+	for _, line := range strings.Split(FormatPlainTextArticle(entry), "\n") {
+		if line != "" {
+			article.WriteString("   ")
+			article.WriteString(line)
+		}
+
+		article.WriteString("\n")
+	}
+
+	headwords := []string{entry.Word}
+
+	for _, form := range entry.AlternativeForms {
+		if form != entry.Word {
+			headwords = append(headwords, form)
+		}
+	}
+
+	return dw.writeArticle(headwords, article.String())
+}
+
+func (dw *dictdWriter) Close() error {
+	if err := dw.out.Flush(); err != nil {
+		dw.dict.Close()
+		return errors.Wrap(err, "could not flush dictionary file")
+	}
+
+	if err := dw.dict.Close(); err != nil {
+		return errors.Wrap(err, "could not close dictionary file")
+	}
+
+	// dictd uses binary search on the index. With 00-database-allchars and
+	// 00-database-utf8 set, it compares headwords case-insensitively.
+
+	sort.SliceStable(dw.index, func(i, j int) bool {
+		return dictdLess(dw.index[i].headword, dw.index[j].headword)
+	})
+
+	err := writeFileWith(dw.basePath+".index", func(out *bufio.Writer) error {
+		for _, entry := range dw.index {
+			fmt.Fprintf(out, "%v\t%v\t%v\n", entry.headword, dictdBase64(entry.offset), dictdBase64(entry.length))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	dictPath := dw.basePath + ".dict"
+
+	if err := CompressToDictzip(dictPath, dictPath+".dz"); err != nil {
+		return errors.Wrap(err, "could not compress dictionary file")
+	}
+
+	return os.Remove(dictPath)
+}
+
+// Append article to the dictionary file and list it under all headwords.
+func (dw *dictdWriter) writeArticle(headwords []string, article string) error {
+	if _, err := dw.out.WriteString(article); err != nil {
+		return errors.Wrap(err, "could not write article")
+	}
+
+	for _, headword := range headwords {
+		// Tabs and newlines would break the index.
+
+		headword = strings.Join(strings.Fields(headword), " ")
+
+		dw.index = append(dw.index, dictdIndexEntry{
+			headword: headword,
+			offset:   dw.offset,
+			length:   int64(len(article)),
+		})
+	}
+
+	dw.offset += int64(len(article))
+	return nil
+}
+
+// Return whether a sorts before b in a dictd index.
+func dictdLess(a, b string) bool {
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+
+	if la != lb {
+		return la < lb
+	}
+
+	return a < b
+}
+
+// Encode n with the base64 variant dictd uses for numbers in its index.
+// Unlike regular base64, the number is written most significant digit first
+// without any padding.
+func dictdBase64(n int64) string {
+	if n == 0 {
+		return DICTD_BASE64_DIGITS[:1]
+	}
+
+	var digits []byte
+
+	for ; n > 0; n /= 64 {
+		digits = append([]byte{DICTD_BASE64_DIGITS[n%64]}, digits...)
+	}
+
+	return string(digits)
+}
@@ -0,0 +1,652 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kissen/wikidictools/wikidictdb"
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Time a client may stay idle before we close the connection.
+const DICT_IDLE_TIMEOUT = 10 * time.Minute
+
+// Maximum length of a command line; RFC 2229 limits lines to 1024 bytes.
+const DICT_MAX_LINE_LENGTH = 1024
+
+// A DICT protocol (RFC 2229) server that answers queries from a database
+// created by wdictosqlite. The server offers the database under a single
+// name.
+type dictServer struct {
+	db          *wikidictdb.Database
+	name        string
+	description string
+	info        string
+	maxMatches  int
+	hostname    string
+	nconnection uint64
+}
+
+// Output to a single client.
+type dictOutput struct {
+	*bufio.Writer
+
+	// Whether the client asked for a MIME header before each text with
+	// OPTION MIME.
+	mime bool
+}
+
+// A match strategy of the MATCH command.
+type dictStrategy struct {
+	name        string
+	description string
+	match       func(ds *dictServer, word string) ([]string, error)
+}
+
+// All supported strategies. The first one is the default strategy.
+var dictStrategies = []dictStrategy{
+	{"prefix", "Match prefixes", (*dictServer).matchPrefix},
+	{"exact", "Match headwords exactly", (*dictServer).matchExact},
+	{"substring", "Match substring occurring anywhere in a headword", (*dictServer).matchSubstring},
+	{"soundex", "Match using SOUNDEX algorithm", (*dictServer).matchSoundex},
+	{"metaphone", "Match using Double Metaphone algorithm", (*dictServer).matchMetaphone},
+	{"lev", "Match headwords within Levenshtein distance one", (*dictServer).matchLevenshtein},
+	{"re", "Regular expression", (*dictServer).matchRegexp},
+}
+
+// Serve a database over the DICT protocol until killed.
+func RunServeDict(argv []string) error {
+	var (
+		sqlFile    string
+		listen     string
+		name       string
+		maxMatches int
+	)
+
+	flags := flag.NewFlagSet(os.Args[0]+" serve-dict", flag.ExitOnError)
+	flags.StringVar(&sqlFile, "db", "", "database file to serve, required")
+	flags.StringVar(&listen, "listen", ":2628", "address to listen on")
+	flags.StringVar(&name, "name", "wiktionary", "name of the database as seen by clients")
+	flags.IntVar(&maxMatches, "maxmatches", 1000, "maximum number of results for MATCH")
+	flags.Parse(argv)
+
+	if sqlFile == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	db, err := wikidictdb.Open(sqlFile)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	server, err := newDictServer(db, name, maxMatches)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return errors.Wrap(err, "could not listen")
+	}
+
+	defer listener.Close()
+
+	fmt.Fprintf(os.Stderr, "%v: serving %v on %v\n", os.Args[0], sqlFile, listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return errors.Wrap(err, "could not accept connection")
+		}
+
+		go server.serve(conn)
+	}
+}
+
+func newDictServer(db *wikidictdb.Database, name string, maxMatches int) (*dictServer, error) {
+	meta, err := db.Meta()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read meta data")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	description := meta["SourceSiteName"]
+
+	if description == "" {
+		description = "Wiktionary"
+	}
+
+	if languages := meta["Languages"]; languages != "" {
+		description = fmt.Sprintf("%v (%v)", description, languages)
+	}
+
+	info := fmt.Sprintf("%v\n\nCreated on %v.", description, meta["CreatedOn"])
+
+	if copying := meta["Copying"]; copying != "" {
+		info = info + "\n\n" + copying
+	}
+
+	created := &dictServer{
+		db:          db,
+		name:        name,
+		description: description,
+		info:        info,
+		maxMatches:  maxMatches,
+		hostname:    hostname,
+	}
+
+	return created, nil
+}
+
+// Handle a single client until it quits or goes idle.
+func (ds *dictServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	in := bufio.NewReaderSize(conn, DICT_MAX_LINE_LENGTH)
+	out := &dictOutput{Writer: bufio.NewWriter(conn)}
+
+	id := atomic.AddUint64(&ds.nconnection, 1)
+
+	ds.status(out, 220, "%v wdictosqlite <mime> <%v.%v@%v>", ds.hostname, id, time.Now().Unix(), ds.hostname)
+
+	for {
+		if err := out.Flush(); err != nil {
+			return
+		}
+
+		conn.SetReadDeadline(time.Now().Add(DICT_IDLE_TIMEOUT))
+
+		line, isPrefix, err := in.ReadLine()
+		if err != nil {
+			return
+		}
+
+		if isPrefix {
+			ds.status(out, 500, "line too long")
+			return
+		}
+
+		args, err := splitDictCommand(string(line))
+		if err != nil {
+			ds.status(out, 501, "syntax error, illegal parameters")
+			continue
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		if quit := ds.handle(out, args); quit {
+			out.Flush()
+			return
+		}
+	}
+}
+
+// Run the command given by args. Returns whether the connection should
+// be closed.
+func (ds *dictServer) handle(out *dictOutput, args []string) (quit bool) {
+	command := strings.ToUpper(args[0])
+
+	switch {
+	case command == "DEFINE" && len(args) == 3:
+		ds.define(out, args[1], args[2])
+	case command == "MATCH" && len(args) == 4:
+		ds.match(out, args[1], args[2], args[3])
+	case command == "SHOW" && len(args) >= 2:
+		ds.show(out, args[1:])
+	case command == "CLIENT" && len(args) >= 2:
+		ds.status(out, 250, "ok")
+	case command == "OPTION" && len(args) == 2 && strings.ToUpper(args[1]) == "MIME":
+		out.mime = true
+		ds.status(out, 250, "ok - using MIME headers")
+	case command == "STATUS" && len(args) == 1:
+		ds.status(out, 210, "status [d/m/c = 0/0/0; 0.000r 0.000u 0.000s]")
+	case command == "HELP" && len(args) == 1:
+		ds.help(out)
+	case command == "QUIT" && len(args) == 1:
+		ds.status(out, 221, "bye")
+		return true
+	case command == "AUTH" || command == "SASLAUTH":
+		ds.status(out, 502, "command not implemented")
+	case isDictCommand(command):
+		ds.status(out, 501, "syntax error, illegal parameters")
+	default:
+		ds.status(out, 500, "unknown command")
+	}
+
+	return false
+}
+
+func (ds *dictServer) define(out *dictOutput, database string, word string) {
+	if !ds.isOurDatabase(database) {
+		ds.status(out, 550, "invalid database, use \"SHOW DB\" for list of databases")
+		return
+	}
+
+	entry, err := ds.lookup(word)
+
+	if err == wikidictdb.ErrNotFound {
+		ds.status(out, 552, "no match")
+		return
+	}
+
+	if err != nil {
+		ds.serverError(out, err)
+		return
+	}
+
+	ds.status(out, 150, "1 definitions retrieved")
+	ds.status(out, 151, "%v %v %v", quoteDict(entry.Word), ds.name, quoteDict(ds.description))
+
+	var text strings.Builder
+
+	text.WriteString(entry.Word)
+	text.WriteString("\n")
+
+	entry.ForEachPartOfSpeech(func(pos string, definitions []string) bool {
+		fmt.Fprintf(&text, "\n%v\n", pos)
+
+		for i, definition := range definitions {
+			fmt.Fprintf(&text, "\n  %v. %v", i+1, formatDictCrossReferences(definition))
+		}
+
+		text.WriteString("\n")
+		return true
+	})
+
+	ds.text(out, strings.TrimSuffix(text.String(), "\n"))
+	ds.status(out, 250, "ok")
+}
+
+// Look up the entry of word. Clients often send words in lower case, so if
+// there is no exact match we also try lower and title case. Only entries
+// with definitions count as a match.
+func (ds *dictServer) lookup(word string) (*wikidictools.DictionaryEntry, error) {
+	for _, candidate := range uniqueStrings(word, strings.ToLower(word), titleCase(word)) {
+		entry, err := ds.db.Lookup(candidate)
+
+		if err == wikidictdb.ErrNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !entry.IsEmpty() {
+			return entry, nil
+		}
+	}
+
+	return nil, wikidictdb.ErrNotFound
+}
+
+func (ds *dictServer) match(out *dictOutput, database string, strategyName string, word string) {
+	if !ds.isOurDatabase(database) {
+		ds.status(out, 550, "invalid database, use \"SHOW DB\" for list of databases")
+		return
+	}
+
+	strategy, ok := findDictStrategy(strategyName)
+	if !ok {
+		ds.status(out, 551, "invalid strategy, use \"SHOW STRAT\" for a list of strategies")
+		return
+	}
+
+	matches, err := strategy.match(ds, word)
+
+	if _, ok := errors.Cause(err).(*syntax.Error); ok {
+		ds.status(out, 501, "syntax error, illegal parameters")
+		return
+	}
+
+	if err != nil {
+		ds.serverError(out, err)
+		return
+	}
+
+	if len(matches) == 0 {
+		ds.status(out, 552, "no match")
+		return
+	}
+
+	var text strings.Builder
+
+	for i, match := range matches {
+		if i > 0 {
+			text.WriteString("\n")
+		}
+
+		fmt.Fprintf(&text, "%v %v", ds.name, quoteDict(match))
+	}
+
+	ds.status(out, 152, "%v matches found", len(matches))
+	ds.text(out, text.String())
+	ds.status(out, 250, "ok")
+}
+
+func (ds *dictServer) show(out *dictOutput, args []string) {
+	what := strings.ToUpper(args[0])
+
+	switch {
+	case (what == "DB" || what == "DATABASES") && len(args) == 1:
+		ds.status(out, 110, "1 databases present")
+		ds.text(out, fmt.Sprintf("%v %v", ds.name, quoteDict(ds.description)))
+		ds.status(out, 250, "ok")
+	case (what == "STRAT" || what == "STRATEGIES") && len(args) == 1:
+		var text strings.Builder
+
+		for i, strategy := range dictStrategies {
+			if i > 0 {
+				text.WriteString("\n")
+			}
+
+			fmt.Fprintf(&text, "%v %v", strategy.name, quoteDict(strategy.description))
+		}
+
+		ds.status(out, 111, "%v strategies available", len(dictStrategies))
+		ds.text(out, text.String())
+		ds.status(out, 250, "ok")
+	case what == "INFO" && len(args) == 2:
+		if args[1] != ds.name {
+			ds.status(out, 550, "invalid database, use \"SHOW DB\" for list of databases")
+			return
+		}
+
+		ds.status(out, 112, "database information follows")
+		ds.text(out, ds.info)
+		ds.status(out, 250, "ok")
+	case what == "SERVER" && len(args) == 1:
+		ds.status(out, 114, "server information follows")
+		ds.text(out, fmt.Sprintf("wdictosqlite %v serving %v", ToolVersion(), ds.description))
+		ds.status(out, 250, "ok")
+	default:
+		ds.status(out, 501, "syntax error, illegal parameters")
+	}
+}
+
+func (ds *dictServer) help(out *dictOutput) {
+	help := []string{
+		"DEFINE database word         -- look up word in database",
+		"MATCH database strategy word -- match word in database using strategy",
+		"SHOW DB                      -- list all accessible databases",
+		"SHOW STRAT                   -- list available matching strategies",
+		"SHOW INFO database           -- provide information about the database",
+		"SHOW SERVER                  -- provide site-specific information",
+		"CLIENT info                  -- identify client to server",
+		"STATUS                       -- display timing information",
+		"HELP                         -- display this help information",
+		"QUIT                         -- terminate connection",
+	}
+
+	ds.status(out, 113, "help text follows")
+	ds.text(out, strings.Join(help, "\n"))
+	ds.status(out, 250, "ok")
+}
+
+func (ds *dictServer) matchPrefix(word string) ([]string, error) {
+	return headwords(ds.db.Prefix(word, ds.maxMatches, 0))
+}
+
+func (ds *dictServer) matchExact(word string) ([]string, error) {
+	var matches []string
+
+	for _, candidate := range uniqueStrings(word, strings.ToLower(word), titleCase(word)) {
+		ok, err := ds.db.HasWord(candidate)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			matches = append(matches, candidate)
+		}
+	}
+
+	return matches, nil
+}
+
+func (ds *dictServer) matchSubstring(word string) ([]string, error) {
+	return headwords(ds.db.Substring(word, ds.maxMatches, 0))
+}
+
+func (ds *dictServer) matchSoundex(word string) ([]string, error) {
+	return headwords(ds.db.SoundsLike(word, wikidictdb.SoundexKey, ds.maxMatches, 0))
+}
+
+func (ds *dictServer) matchMetaphone(word string) ([]string, error) {
+	return headwords(ds.db.SoundsLike(word, wikidictdb.MetaphoneKey, ds.maxMatches, 0))
+}
+
+func (ds *dictServer) matchLevenshtein(word string) ([]string, error) {
+	// Suggestions count swapped characters as a single edit. Clients
+	// expect plain Levenshtein distance, where that takes two. So we ask
+	// for all suggestions and only keep maxMatches once those are gone.
+
+	suggestions, err := ds.db.Suggest(word, 1, math.MaxInt)
+	if err != nil {
+		return nil, err
+	}
+
+	found := []string{}
+
+	lower := strings.ToLower(word)
+
+	for _, suggestion := range suggestions {
+		if len(found) >= ds.maxMatches {
+			break
+		}
+
+		if wikidictools.LevenshteinDistance(lower, strings.ToLower(suggestion.Headword)) <= 1 {
+			found = append(found, suggestion.Word.Word)
+		}
+	}
+
+	return found, nil
+}
+
+func (ds *dictServer) matchRegexp(word string) ([]string, error) {
+	pattern, err := regexp.Compile(word)
+	if err != nil {
+		return nil, errors.Wrap(err, "bad regular expression")
+	}
+
+	return ds.matchWith(pattern.MatchString)
+}
+
+// Return up to maxMatches words for which matches returns true. This has
+// to look at every word in the database.
+func (ds *dictServer) matchWith(matches func(word string) bool) ([]string, error) {
+	var found []string
+
+	err := ds.db.ForEachWord(func(word wikidictdb.Word) bool {
+		if matches(word.Word) {
+			found = append(found, word.Word)
+		}
+
+		return len(found) < ds.maxMatches
+	})
+
+	return found, err
+}
+
+// Return only the words of the results of a query.
+func headwords(words []wikidictdb.Word, err error) ([]string, error) {
+	var found []string
+
+	for _, word := range words {
+		found = append(found, word.Word)
+	}
+
+	return found, err
+}
+
+// Return whether database refers to the database we serve. Besides its
+// name, clients may use "*" for all and "!" for the first matching database.
+func (ds *dictServer) isOurDatabase(database string) bool {
+	return database == ds.name || database == "*" || database == "!"
+}
+
+// Write a status line.
+func (ds *dictServer) status(out *dictOutput, code int, format string, args ...any) {
+	fmt.Fprintf(out, "%03d %v\r\n", code, fmt.Sprintf(format, args...))
+}
+
+// Write text followed by the terminating "." line. Lines starting with a
+// period get another period prepended. After OPTION MIME, the text starts
+// with a MIME header and a blank line.
+func (ds *dictServer) text(out *dictOutput, text string) {
+	if out.mime {
+		out.WriteString("Content-type: text/plain; charset=utf-8\r\n")
+		out.WriteString("Content-transfer-encoding: 8bit\r\n")
+		out.WriteString("\r\n")
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, ".") {
+			out.WriteString(".")
+		}
+
+		out.WriteString(line)
+		out.WriteString("\r\n")
+	}
+
+	out.WriteString(".\r\n")
+}
+
+// Report an internal error to the client and log it.
+func (ds *dictServer) serverError(out *dictOutput, err error) {
+	fmt.Fprintf(os.Stderr, "%v: error: %v\n", os.Args[0], err)
+	ds.status(out, 420, "server temporarily unavailable")
+}
+
+// Return the strategy with the given name. The name "." refers to the
+// default strategy.
+func findDictStrategy(name string) (dictStrategy, bool) {
+	if name == "." {
+		return dictStrategies[0], true
+	}
+
+	for _, strategy := range dictStrategies {
+		if strings.EqualFold(strategy.name, name) {
+			return strategy, true
+		}
+	}
+
+	return dictStrategy{}, false
+}
+
+// Return whether command is one the server knows, even if it was used
+// with the wrong arguments.
+func isDictCommand(command string) bool {
+	switch command {
+	case "DEFINE", "MATCH", "SHOW", "CLIENT", "OPTION", "STATUS", "HELP", "QUIT":
+		return true
+	default:
+		return false
+	}
+}
+
+// Split a command line into its words. Words may be quoted with single or
+// double quotes; inside quotes, a backslash escapes the next character.
+func splitDictCommand(line string) ([]string, error) {
+	var (
+		words   []string
+		current strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote != 0 && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote")
+	}
+
+	if inWord {
+		words = append(words, current.String())
+	}
+
+	return words, nil
+}
+
+// Quote s for use as a single word in a response.
+func quoteDict(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return "\"" + s + "\""
+}
+
+// Replace [[links]] in definition with the {braces} DICT clients use for
+// cross references.
+func formatDictCrossReferences(definition string) string {
+	return strings.NewReplacer("[[", "{", "]]", "}").Replace(definition)
+}
+
+// Return word with its first letter in upper case.
+func titleCase(word string) string {
+	first, size := utf8.DecodeRuneInString(word)
+
+	if first == utf8.RuneError {
+		return word
+	}
+
+	return strings.ToUpper(string(first)) + word[size:]
+}
+
+// Return the arguments without duplicates, in order.
+func uniqueStrings(ss ...string) (unique []string) {
+	seen := make(map[string]bool)
+
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+
+	return unique
+}
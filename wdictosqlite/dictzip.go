@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Number of uncompressed bytes per dictzip chunk. This is what dictzip
+// itself uses; it guarantees that each compressed chunk fits into the
+// 16 bit sizes of the chunk table even in the worst case.
+const DICTZIP_CHUNK_LENGTH = 58315
+
+// Maximum number of chunks; the chunk table has to fit into the 16 bit
+// length of the gzip extra field.
+const DICTZIP_MAX_CHUNKS = (0xffff - 10) / 2
+
+// Compress the file at srcPath into dictzip format and write the result to
+// dstPath. Files in dictzip format are valid gzip files. In addition, they
+// are split into chunks that are compressed independently and listed in the
+// header, which allows dictionary servers and readers to look up entries
+// without decompressing the whole file.
+func CompressToDictzip(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return errors.Wrap(err, "could not open uncompressed file")
+	}
+
+	defer src.Close()
+
+	// The header lists the sizes of all chunks, so we can only write it
+	// once all chunks are compressed. Until then, chunks go into a
+	// temporary file.
+
+	chunks, err := os.CreateTemp(filepath.Dir(dstPath), ".dictzip-*")
+	if err != nil {
+		return errors.Wrap(err, "could not create temporary file")
+	}
+
+	defer os.Remove(chunks.Name())
+	defer chunks.Close()
+
+	sizes, checksum, length, err := compressChunks(chunks, src)
+	if err != nil {
+		return err
+	}
+
+	if len(sizes) > DICTZIP_MAX_CHUNKS {
+		return errors.Errorf("%v is too large for dictzip", srcPath)
+	}
+
+	if _, err := chunks.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "could not rewind temporary file")
+	}
+
+	// Now write the actual file.
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return errors.Wrap(err, "could not create compressed file")
+	}
+
+	out := bufio.NewWriter(dst)
+
+	header := dictzipHeader(sizes, filepath.Base(srcPath))
+
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer[0:4], checksum)
+	binary.LittleEndian.PutUint32(trailer[4:8], uint32(length))
+
+	if _, err := out.Write(header); err != nil {
+		dst.Close()
+		return errors.Wrap(err, "could not write header")
+	}
+
+	if _, err := io.Copy(out, chunks); err != nil {
+		dst.Close()
+		return errors.Wrap(err, "could not copy compressed chunks")
+	}
+
+	if _, err := out.Write(trailer); err != nil {
+		dst.Close()
+		return errors.Wrap(err, "could not write trailer")
+	}
+
+	if err := out.Flush(); err != nil {
+		dst.Close()
+		return errors.Wrap(err, "could not flush compressed file")
+	}
+
+	return dst.Close()
+}
+
+// Compress src chunk by chunk into dst. Returns the compressed size of each
+// chunk as well as CRC-32 and length of the uncompressed data.
+func compressChunks(dst io.Writer, src io.Reader) (sizes []uint16, checksum uint32, length int64, err error) {
+	in := bufio.NewReader(src)
+	chunk := make([]byte, DICTZIP_CHUNK_LENGTH)
+	crc := crc32.NewIEEE()
+
+	var compressed bytes.Buffer
+
+	for {
+		n, readErr := io.ReadFull(in, chunk)
+
+		if n > 0 {
+			crc.Write(chunk[:n])
+			length += int64(n)
+
+			// Each chunk gets a fresh compressor so that it does not refer
+			// back to earlier chunks. Flush ends the chunk on a byte boundary
+			// without marking the end of the stream.
+
+			compressed.Reset()
+
+			compressor, err := flate.NewWriter(&compressed, flate.BestCompression)
+			if err != nil {
+				return nil, 0, 0, errors.Wrap(err, "could not create compressor")
+			}
+
+			if _, err := compressor.Write(chunk[:n]); err != nil {
+				return nil, 0, 0, errors.Wrap(err, "could not compress chunk")
+			}
+
+			if err := compressor.Flush(); err != nil {
+				return nil, 0, 0, errors.Wrap(err, "could not compress chunk")
+			}
+
+			sizes = append(sizes, uint16(compressed.Len()))
+
+			if _, err := dst.Write(compressed.Bytes()); err != nil {
+				return nil, 0, 0, errors.Wrap(err, "could not write compressed chunk")
+			}
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if readErr != nil {
+			return nil, 0, 0, errors.Wrap(readErr, "could not read uncompressed file")
+		}
+	}
+
+	// Finally, mark the end of the deflate stream with an empty final block.
+	// It becomes part of the last chunk.
+
+	compressed.Reset()
+
+	compressor, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return nil, 0, 0, errors.Wrap(err, "could not create compressor")
+	}
+
+	if err := compressor.Close(); err != nil {
+		return nil, 0, 0, errors.Wrap(err, "could not end compressed stream")
+	}
+
+	if len(sizes) > 0 {
+		sizes[len(sizes)-1] += uint16(compressed.Len())
+	}
+
+	if _, err := dst.Write(compressed.Bytes()); err != nil {
+		return nil, 0, 0, errors.Wrap(err, "could not write end of compressed stream")
+	}
+
+	return sizes, crc.Sum32(), length, nil
+}
+
+// Return the gzip header for a dictzip file with the given chunk sizes.
+func dictzipHeader(sizes []uint16, name string) []byte {
+	const (
+		FEXTRA = 1 << 2
+		FNAME  = 1 << 3
+	)
+
+	var header bytes.Buffer
+
+	// Fixed gzip header: magic, deflate, flags, no modification time,
+	// maximum compression, Unix.
+
+	header.Write([]byte{0x1f, 0x8b, 8, FEXTRA | FNAME, 0, 0, 0, 0, 2, 3})
+
+	// The extra field contains a single "RA" subfield with the chunk table.
+
+	subfield := make([]byte, 0, 6+2*len(sizes))
+	subfield = appendUint16(subfield, 1)
+	subfield = appendUint16(subfield, DICTZIP_CHUNK_LENGTH)
+	subfield = appendUint16(subfield, uint16(len(sizes)))
+
+	for _, size := range sizes {
+		subfield = appendUint16(subfield, size)
+	}
+
+	extra := []byte{'R', 'A'}
+	extra = appendUint16(extra, uint16(len(subfield)))
+	extra = append(extra, subfield...)
+
+	header.Write(appendUint16(nil, uint16(len(extra))))
+	header.Write(extra)
+
+	// Original file name, zero terminated.
+
+	header.WriteString(name)
+	header.WriteByte(0)
+
+	return header.Bytes()
+}
+
+// Append v to b in little endian byte order.
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+// Append v to b in little endian byte order.
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// Append v to b in little endian byte order.
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v)), uint32(v>>32))
+}
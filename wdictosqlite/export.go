@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Name of the default output format.
+const SQLITE_FORMAT = "sqlite"
+
+// A destination for dictionary entries in a format other than SQLite.
+type EntryWriter interface {
+	// Write a single entry. Writers may skip entries they cannot represent.
+	WriteEntry(entry *wikidictools.DictionaryEntry) error
+
+	// Finish writing. Must be called exactly once after the last entry was
+	// written. Formats that need an index write it here.
+	io.Closer
+}
+
+// Creates an EntryWriter for the given arguments and the dump described
+// by siteInfo.
+type EntryWriterConstructor func(args *Arguments, siteInfo wikidictools.SiteInfo) (EntryWriter, error)
+
+// Output formats other than SQLite, keyed by the name given to -format.
+var entryWriters = map[string]EntryWriterConstructor{
+	"jsonl":    NewJsonLinesWriter,
+	"stardict": NewStarDictWriter,
+	"dictd":    NewDictdWriter,
+	"tei":      NewTeiWriter,
+	"zim":      NewZimWriter,
+	"ntriples": NewNTriplesWriter,
+	"turtle":   NewTurtleWriter,
+	"apple":    NewAppleDictionaryWriter,
+	"kindle":   NewKindleWriter,
+}
+
+// Write all entries read from src to dst and close dst. Entries without any
+// content are skipped just like when filling a database.
+func ExportEntries(dst EntryWriter, src wikidictools.XmlParser) error {
+	nwritten := 0
+
+	for {
+		entry, err := src.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			dst.Close()
+			return errors.Wrap(err, "error while getting next XML entry")
+		}
+
+		if entry.IsEmpty() && entry.Reconstruction == nil && entry.Thesaurus == nil {
+			continue
+		}
+
+		if err := dst.WriteEntry(entry); err != nil {
+			dst.Close()
+			return errors.Wrapf(err, "could not write entry for word=%v", entry.Word)
+		}
+
+		nwritten += 1
+
+		if nwritten%1000 == 0 {
+			fmt.Fprintf(os.Stderr, "\r%v: exported %v words", os.Args[0], nwritten)
+		}
+	}
+
+	if err := dst.Close(); err != nil {
+		return errors.Wrap(err, "could not finish writing output")
+	}
+
+	fmt.Fprintf(os.Stderr, "\n%v: done exporting %v words\n", os.Args[0], nwritten)
+	return nil
+}
+
+// Open file for writing, truncating it if it exists. Just like -infile,
+// "--" refers to stdout.
+func OpenOutputFile(fileLocation string) (io.WriteCloser, error) {
+	if fileLocation == "--" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	fd, err := os.Create(fileLocation)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create output file")
+	}
+
+	return fd, nil
+}
+
+// Create file at path and fill it with write. The file is buffered; write
+// need not check errors of individual writes.
+func writeFileWith(path string, write func(out *bufio.Writer) error) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "could not create %v", path)
+	}
+
+	out := bufio.NewWriter(fd)
+
+	if err := write(out); err != nil {
+		fd.Close()
+		return errors.Wrapf(err, "could not write %v", path)
+	}
+
+	if err := out.Flush(); err != nil {
+		fd.Close()
+		return errors.Wrapf(err, "could not write %v", path)
+	}
+
+	return fd.Close()
+}
+
+// Return the contents of the file given with -copying or the empty string
+// if there is none.
+func ReadCopying(args *Arguments) (string, error) {
+	if args.Copying == "" {
+		return "", nil
+	}
+
+	contents, err := ioutil.ReadFile(args.Copying)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not read file %v", args.Copying)
+	}
+
+	return string(contents), nil
+}
+
+// BCP 47 code of the language of exported entries. The parser only
+// extracts English definitions.
+const LANGUAGE_CODE = "en"
+
+// Return a human readable title for dictionaries created from the dump,
+// e.g. "Wiktionary (English)".
+func DictionaryTitle(siteInfo wikidictools.SiteInfo) string {
+	name := siteInfo.SiteName
+
+	if name == "" {
+		name = "Wiktionary"
+	}
+
+	return fmt.Sprintf("%v (English)", name)
+}
+
+// Format entry as plain text with each part of speech followed by its
+// numbered definitions. Links are replaced by their text.
+func FormatPlainTextArticle(entry *wikidictools.DictionaryEntry) string {
+	var article strings.Builder
+
+	entry.ForEachPartOfSpeech(func(partOfSpeech string, definitions []string) bool {
+		if article.Len() > 0 {
+			article.WriteString("\n\n")
+		}
+
+		article.WriteString(partOfSpeech)
+
+		for i, definition := range definitions {
+			fmt.Fprintf(&article, "\n%v. %v", i+1, wikidictools.StripLinksFrom(definition))
+		}
+
+		return true
+	})
+
+	return article.String()
+}
+
+// Return s escaped for use as text or in an attribute value.
+func xmlEscape(s string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
+
+// Return word encoded as an XML name, usable as an ID or the first part
+// of one. Letters, digits and hyphens are kept. All other characters are
+// replaced by their code point in hex surrounded by underscores, so
+// different words always get different IDs.
+func xmlId(word string) string {
+	var id strings.Builder
+
+	for i, r := range word {
+		switch {
+		case unicode.IsLetter(r):
+			id.WriteRune(r)
+		case i > 0 && (unicode.IsDigit(r) || unicode.IsMark(r) || r == '-'):
+			id.WriteRune(r)
+		default:
+			fmt.Fprintf(&id, "_%x_", r)
+		}
+	}
+
+	return id.String()
+}
+
+// Wraps a Writer that must not be closed, e.g. stdout.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
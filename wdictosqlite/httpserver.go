@@ -0,0 +1,510 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictdb"
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Number of results per page if the client does not ask for a limit.
+const HTTP_DEFAULT_LIMIT = 50
+
+// Maximum number of results per page.
+const HTTP_MAX_LIMIT = 1000
+
+// Maximum offset for lists that have to fetch all results before the
+// requested page.
+const HTTP_MAX_RANKED_OFFSET = 10000
+
+// A JSON API over a database created by wdictosqlite.
+type httpServer struct {
+	db *wikidictdb.Database
+
+	// Identifies the contents of the database. Changes whenever the
+	// database is created from another dump.
+	databaseTag string
+}
+
+// Body of word responses.
+type httpWordResponse struct {
+	NReferences int64                         `json:"nreferences"`
+	Score       float64                       `json:"score"`
+	Entry       *wikidictools.DictionaryEntry `json:"entry"`
+}
+
+// A page of results of a list query.
+type httpListResponse struct {
+	Results []wikidictdb.Word `json:"results"`
+	Limit   int               `json:"limit"`
+	Offset  int               `json:"offset"`
+}
+
+// A page of results of a fuzzy lookup.
+type httpSuggestResponse struct {
+	Results []wikidictdb.Suggestion `json:"results"`
+	Limit   int                     `json:"limit"`
+	Offset  int                     `json:"offset"`
+}
+
+// Body of all error responses.
+type httpErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Returned by queries to signal that the client asked for something
+// impossible.
+type errBadRequest struct {
+	message string
+}
+
+func (e errBadRequest) Error() string {
+	return e.message
+}
+
+// Serve a database over HTTP until killed.
+func RunServe(argv []string) error {
+	var sqlFile, listen string
+
+	flags := flag.NewFlagSet(os.Args[0]+" serve", flag.ExitOnError)
+	flags.StringVar(&sqlFile, "db", "", "database file to serve, required")
+	flags.StringVar(&listen, "listen", ":8080", "address to listen on")
+	flags.Parse(argv)
+
+	if sqlFile == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	db, err := wikidictdb.Open(sqlFile)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	server, err := newHttpServer(db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%v: serving %v on %v\n", os.Args[0], sqlFile, listen)
+
+	if err := http.ListenAndServe(listen, server.routes()); err != nil {
+		return errors.Wrap(err, "could not serve")
+	}
+
+	return nil
+}
+
+func newHttpServer(db *wikidictdb.Database) (*httpServer, error) {
+	meta, err := db.Meta()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read meta data")
+	}
+
+	// The most recent revision in the dump together with the creation date
+	// tells apart all databases we ever created. Migrations add to what we
+	// return for the same database, so the schema version counts as well.
+
+	hash := fnv.New64a()
+	fmt.Fprintf(
+		hash, "%v\x00%v\x00%v\x00%v",
+		meta["SourceDbName"], meta["LatestRevision"], meta["CreatedOn"], meta[SCHEMA_VERSION_KEY],
+	)
+
+	created := &httpServer{
+		db:          db,
+		databaseTag: strconv.FormatUint(hash.Sum64(), 36),
+	}
+
+	return created, nil
+}
+
+func (hs *httpServer) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/words/", hs.getWord)
+	mux.HandleFunc("/words", hs.listPrefix)
+	mux.HandleFunc("/complete", hs.complete)
+	mux.HandleFunc("/search", hs.search)
+	mux.HandleFunc("/soundslike", hs.soundsLike)
+	mux.HandleFunc("/suggest", hs.suggest)
+	mux.HandleFunc("/random", hs.random)
+	mux.HandleFunc("/popular", hs.popular)
+
+	return mux
+}
+
+// GET /words/{word}
+func (hs *httpServer) getWord(w http.ResponseWriter, r *http.Request) {
+	if !hs.allowGet(w, r) {
+		return
+	}
+
+	word := strings.TrimPrefix(r.URL.Path, "/words/")
+
+	response, err := hs.lookup(word)
+
+	// Clients often get case or apostrophes wrong. In that case we answer
+	// with the most referenced word that is spelled alike.
+
+	if err == wikidictdb.ErrNotFound {
+		var alike []wikidictdb.Word
+
+		if alike, err = hs.db.Normalized(word); err == nil && len(alike) > 0 {
+			response, err = hs.lookup(alike[0].Word)
+		} else if err == nil {
+			err = wikidictdb.ErrNotFound
+		}
+	}
+
+	if err == wikidictdb.ErrNotFound {
+		hs.writeError(w, http.StatusNotFound, "no such word")
+		return
+	}
+
+	if err != nil {
+		hs.serverError(w, err)
+		return
+	}
+
+	// Pages only change with a new revision.
+
+	etag := fmt.Sprintf(`"%v-%v"`, hs.databaseTag, response.Entry.Revision)
+	hs.writeTaggedJson(w, r, etag, response)
+}
+
+// GET /words?prefix=...&limit=...&offset=...
+func (hs *httpServer) listPrefix(w http.ResponseWriter, r *http.Request) {
+	hs.list(w, r, func(limit, offset int) ([]wikidictdb.Word, error) {
+		return hs.db.Prefix(r.URL.Query().Get("prefix"), limit, offset)
+	})
+}
+
+// GET /complete?prefix=...&limit=...&offset=...
+func (hs *httpServer) complete(w http.ResponseWriter, r *http.Request) {
+	hs.list(w, r, func(limit, offset int) ([]wikidictdb.Word, error) {
+		// Like suggestions, completions need all pages before the
+		// requested one.
+
+		if offset > HTTP_MAX_RANKED_OFFSET {
+			return nil, errBadRequest{fmt.Sprintf("offset must not be larger than %v", HTTP_MAX_RANKED_OFFSET)}
+		}
+
+		results, err := hs.db.Complete(r.URL.Query().Get("prefix"), offset+limit)
+
+		if offset < len(results) {
+			return results[offset:], err
+		}
+
+		return []wikidictdb.Word{}, err
+	})
+}
+
+// GET /search?q=...&limit=...&offset=...
+func (hs *httpServer) search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	if query == "" {
+		hs.writeError(w, http.StatusBadRequest, "missing query parameter q")
+		return
+	}
+
+	hs.list(w, r, func(limit, offset int) ([]wikidictdb.Word, error) {
+		results, err := hs.db.Search(query, limit, offset)
+
+		// SQLite reports bad queries only once it runs them.
+
+		if err != nil && strings.Contains(err.Error(), "malformed MATCH expression") {
+			return nil, errBadRequest{"malformed query"}
+		}
+
+		return results, err
+	})
+}
+
+// GET /soundslike?q=...&key=...&limit=...&offset=...
+func (hs *httpServer) soundsLike(w http.ResponseWriter, r *http.Request) {
+	word := r.URL.Query().Get("q")
+
+	if word == "" {
+		hs.writeError(w, http.StatusBadRequest, "missing query parameter q")
+		return
+	}
+
+	name := r.URL.Query().Get("key")
+
+	if name == "" {
+		name = "metaphone"
+	}
+
+	key, ok := wikidictdb.PhoneticKeyNamed(name)
+
+	if !ok {
+		hs.writeError(w, http.StatusBadRequest, "unknown phonetic key")
+		return
+	}
+
+	hs.list(w, r, func(limit, offset int) ([]wikidictdb.Word, error) {
+		return hs.db.SoundsLike(word, key, limit, offset)
+	})
+}
+
+// GET /suggest?q=...&distance=...&limit=...&offset=...
+func (hs *httpServer) suggest(w http.ResponseWriter, r *http.Request) {
+	if !hs.allowGet(w, r) {
+		return
+	}
+
+	word := r.URL.Query().Get("q")
+
+	if word == "" {
+		hs.writeError(w, http.StatusBadRequest, "missing query parameter q")
+		return
+	}
+
+	distance := wikidictools.FUZZY_MAX_DISTANCE
+
+	if s := r.URL.Query().Get("distance"); s != "" {
+		var err error
+
+		if distance, err = strconv.Atoi(s); err != nil || distance < 0 || distance > wikidictools.FUZZY_MAX_DISTANCE {
+			hs.writeError(w, http.StatusBadRequest, fmt.Sprintf("distance must be between 0 and %v", wikidictools.FUZZY_MAX_DISTANCE))
+			return
+		}
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		hs.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Suggestions are ranked in Go, so there is no way around fetching
+	// the pages before the requested one.
+
+	if offset > HTTP_MAX_RANKED_OFFSET {
+		hs.writeError(w, http.StatusBadRequest, fmt.Sprintf("offset must not be larger than %v", HTTP_MAX_RANKED_OFFSET))
+		return
+	}
+
+	results, err := hs.db.Suggest(word, distance, offset+limit)
+	if err != nil {
+		hs.serverError(w, err)
+		return
+	}
+
+	if offset < len(results) {
+		results = results[offset:]
+	} else {
+		results = []wikidictdb.Suggestion{}
+	}
+
+	// Lists only change with the database.
+
+	hs.writeTaggedJson(w, r, `"`+hs.databaseTag+`"`, httpSuggestResponse{
+		Results: results,
+		Limit:   limit,
+		Offset:  offset,
+	})
+}
+
+// GET /popular?by=...&limit=...&offset=...
+func (hs *httpServer) popular(w http.ResponseWriter, r *http.Request) {
+	by := r.URL.Query().Get("by")
+
+	if by != "" && by != "references" && by != "score" {
+		hs.writeError(w, http.StatusBadRequest, "by must be references or score")
+		return
+	}
+
+	if by == "score" && !hs.db.HasScores() {
+		hs.writeError(w, http.StatusBadRequest, "database has no scores, run \"wdictosqlite migrate\" on it")
+		return
+	}
+
+	hs.list(w, r, func(limit, offset int) ([]wikidictdb.Word, error) {
+		if by == "score" {
+			return hs.db.HighestScored(limit, offset)
+		}
+
+		return hs.db.MostReferenced(limit, offset)
+	})
+}
+
+// GET /random
+func (hs *httpServer) random(w http.ResponseWriter, r *http.Request) {
+	if !hs.allowGet(w, r) {
+		return
+	}
+
+	word, err := hs.db.RandomWord()
+
+	if err == wikidictdb.ErrNotFound {
+		hs.writeError(w, http.StatusNotFound, "database is empty")
+		return
+	}
+
+	if err != nil {
+		hs.serverError(w, err)
+		return
+	}
+
+	response, err := hs.lookup(word)
+	if err != nil {
+		hs.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	hs.writeJson(w, http.StatusOK, response)
+}
+
+// Return the response body for word.
+func (hs *httpServer) lookup(word string) (*httpWordResponse, error) {
+	entry, err := hs.db.Lookup(word)
+	if err != nil {
+		return nil, err
+	}
+
+	nreferences, err := hs.db.NReferences(word)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files from before PageRank scores have none; we leave them at 0.
+
+	var score float64
+
+	if hs.db.HasScores() {
+		if score, err = hs.db.Score(word); err != nil {
+			return nil, err
+		}
+	}
+
+	return &httpWordResponse{NReferences: nreferences, Score: score, Entry: entry}, nil
+}
+
+// Answer a paginated list request with the results of query.
+func (hs *httpServer) list(w http.ResponseWriter, r *http.Request, query func(limit, offset int) ([]wikidictdb.Word, error)) {
+	if !hs.allowGet(w, r) {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		hs.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := query(limit, offset)
+
+	if bad, ok := err.(errBadRequest); ok {
+		hs.writeError(w, http.StatusBadRequest, bad.message)
+		return
+	}
+
+	if err != nil {
+		hs.serverError(w, err)
+		return
+	}
+
+	// Lists only change with the database.
+
+	hs.writeTaggedJson(w, r, `"`+hs.databaseTag+`"`, httpListResponse{
+		Results: results,
+		Limit:   limit,
+		Offset:  offset,
+	})
+}
+
+// Return whether the request uses GET or HEAD. Otherwise answers with an
+// error and returns false.
+func (hs *httpServer) allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+
+	w.Header().Set("Allow", "GET, HEAD")
+	hs.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+	return false
+}
+
+// Answer with body and the given ETag. If the client already has the
+// current version, answers with 304 Not Modified instead. Only successful
+// responses carry an ETag.
+func (hs *httpServer) writeTaggedJson(w http.ResponseWriter, r *http.Request, etag string, body any) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		hs.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	writeEncodedJson(w, http.StatusOK, encoded)
+}
+
+func (hs *httpServer) writeJson(w http.ResponseWriter, status int, body any) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		hs.serverError(w, err)
+		return
+	}
+
+	writeEncodedJson(w, status, encoded)
+}
+
+func writeEncodedJson(w http.ResponseWriter, status int, encoded []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(encoded)
+}
+
+func (hs *httpServer) writeError(w http.ResponseWriter, status int, message string) {
+	hs.writeJson(w, status, httpErrorResponse{Error: message})
+}
+
+// Log err and answer with 500 Internal Server Error.
+func (hs *httpServer) serverError(w http.ResponseWriter, err error) {
+	fmt.Fprintf(os.Stderr, "%v: error: %v\n", os.Args[0], err)
+	hs.writeError(w, http.StatusInternalServerError, "internal server error")
+}
+
+// Return limit and offset given as query parameters.
+func parsePagination(r *http.Request) (limit int, offset int, err error) {
+	limit, offset = HTTP_DEFAULT_LIMIT, 0
+
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > HTTP_MAX_LIMIT {
+			return 0, 0, errors.Errorf("limit must be between 1 and %v", HTTP_MAX_LIMIT)
+		}
+	}
+
+	if s := r.URL.Query().Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must not be negative")
+		}
+	}
+
+	return limit, offset, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Writes one JSON object per line. Entries are encoded with
+// DictionaryEntry.MarshalJSON and can be read back with
+// wikidictools.NewJsonLinesReader.
+type jsonLinesWriter struct {
+	file     io.WriteCloser
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func NewJsonLinesWriter(args *Arguments, _ wikidictools.SiteInfo) (EntryWriter, error) {
+	file, err := OpenOutputFile(args.OutFile)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewWriter(file)
+
+	encoder := json.NewEncoder(buffered)
+	encoder.SetEscapeHTML(false)
+
+	created := &jsonLinesWriter{
+		file:     file,
+		buffered: buffered,
+		encoder:  encoder,
+	}
+
+	return created, nil
+}
+
+func (jw *jsonLinesWriter) WriteEntry(entry *wikidictools.DictionaryEntry) error {
+	// Encode always ends its output with a newline, which is exactly
+	// what we need.
+	return jw.encoder.Encode(entry)
+}
+
+func (jw *jsonLinesWriter) Close() error {
+	if err := jw.buffered.Flush(); err != nil {
+		jw.file.Close()
+		return errors.Wrap(err, "could not flush output")
+	}
+
+	return jw.file.Close()
+}
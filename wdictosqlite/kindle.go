@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Namespace of the idx: and mbp: elements Kindle dictionaries use.
+const KINDLE_NAMESPACE = "https://kindlegen.s3.amazonaws.com/AmazonKindlePublishingGuidelines.pdf"
+
+// End of the XHTML file of each volume.
+const KINDLE_VOLUME_FOOTER = "</mbp:frameset>\n</body>\n</html>\n"
+
+// Writes a Kindle dictionary as OPF and XHTML for Kindle Previewer or
+// kindlegen. Given -outfile NAME, it creates NAME-1.opf and NAME-1.xhtml.
+// Once the XHTML file of a volume would grow larger than -volumesize, it
+// continues with NAME-2.opf and NAME-2.xhtml and so on. Each volume can be
+// converted into a dictionary of its own.
+type kindleWriter struct {
+	basePath      string
+	title         string
+	createdOn     string
+	copying       string
+	identifier    string
+	maxVolumeSize int64
+
+	volume     *os.File
+	out        *bufio.Writer
+	volumeSize int64
+	nentries   int
+	nvolumes   int
+}
+
+func NewKindleWriter(args *Arguments, siteInfo wikidictools.SiteInfo) (EntryWriter, error) {
+	copying, err := ReadCopying(args)
+	if err != nil {
+		return nil, err
+	}
+
+	created := &kindleWriter{
+		basePath:      args.OutFile,
+		title:         DictionaryTitle(siteInfo),
+		createdOn:     args.CreatedOn,
+		copying:       strings.TrimSpace(copying),
+		identifier:    "urn:wikidictools:" + siteInfo.DbName + ":" + args.CreatedOn,
+		maxVolumeSize: int64(args.VolumeSize) * 1024 * 1024,
+	}
+
+	if err := created.openVolume(); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (kw *kindleWriter) WriteEntry(entry *wikidictools.DictionaryEntry) error {
+	if entry.IsEmpty() {
+		return nil
+	}
+
+	var article strings.Builder
+
+	// The orth is what Kindle looks up. Inflected and alternative forms
+	// each get a group of their own that leads to the same entry.
+
+	fmt.Fprintf(&article, "<idx:entry name=\"default\" scriptable=\"yes\" spell=\"yes\">\n")
+	fmt.Fprintf(&article, "<idx:orth value=\"%v\"><b>%v</b>\n", xmlEscape(entry.Word), xmlEscape(entry.Word))
+
+	for _, group := range [][]string{entry.Inflections, entry.AlternativeForms} {
+		if len(group) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&article, "<idx:infl>\n")
+
+		for _, form := range group {
+			fmt.Fprintf(&article, "<idx:iform value=\"%v\"/>\n", xmlEscape(form))
+		}
+
+		fmt.Fprintf(&article, "</idx:infl>\n")
+	}
+
+	fmt.Fprintf(&article, "</idx:orth>\n")
+
+	if len(entry.Pronunciations) > 0 {
+		fmt.Fprintf(&article, "<p>%v</p>\n", xmlEscape(strings.Join(entry.Pronunciations, ", ")))
+	}
+
+	// Kindle has no way to follow links between entries, so we keep
+	// just their text.
+
+	entry.ForEachPartOfSpeech(func(partOfSpeech string, definitions []string) bool {
+		fmt.Fprintf(&article, "<p><i>%v</i></p>\n", partOfSpeech)
+		fmt.Fprintf(&article, "<ol>\n")
+
+		for _, definition := range definitions {
+			fmt.Fprintf(&article, "<li>%v</li>\n", formatHtmlDefinition(definition, func(_, text string) string {
+				return text
+			}))
+		}
+
+		fmt.Fprintf(&article, "</ol>\n")
+		return true
+	})
+
+	fmt.Fprintf(&article, "</idx:entry>\n")
+	fmt.Fprintf(&article, "<hr/>\n")
+
+	// Never leave a volume empty, even if a single entry is larger than
+	// the limit.
+
+	size := int64(article.Len())
+
+	if kw.maxVolumeSize > 0 && kw.nentries > 0 && kw.volumeSize+size > kw.maxVolumeSize {
+		if err := kw.closeVolume(); err != nil {
+			return err
+		}
+
+		if err := kw.openVolume(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := kw.out.WriteString(article.String()); err != nil {
+		return errors.Wrap(err, "could not write entry")
+	}
+
+	kw.volumeSize += size
+	kw.nentries += 1
+
+	return nil
+}
+
+func (kw *kindleWriter) Close() error {
+	if err := kw.closeVolume(); err != nil {
+		return err
+	}
+
+	// Only now we know how many volumes there are.
+
+	for i := 1; i <= kw.nvolumes; i++ {
+		if err := kw.writePackage(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Start the XHTML file of the next volume.
+func (kw *kindleWriter) openVolume() error {
+	kw.nvolumes += 1
+
+	volume, err := os.Create(kw.volumePath(kw.nvolumes, ".xhtml"))
+	if err != nil {
+		return errors.Wrap(err, "could not create volume")
+	}
+
+	var header strings.Builder
+
+	fmt.Fprintf(&header, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&header, "<html xmlns=\"http://www.w3.org/1999/xhtml\" xmlns:idx=\"%v\" xmlns:mbp=\"%v\">\n", KINDLE_NAMESPACE, KINDLE_NAMESPACE)
+	fmt.Fprintf(&header, "<head>\n")
+	fmt.Fprintf(&header, "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=utf-8\"/>\n")
+	fmt.Fprintf(&header, "<title>%v</title>\n", xmlEscape(kw.title))
+	fmt.Fprintf(&header, "</head>\n")
+	fmt.Fprintf(&header, "<body>\n")
+	fmt.Fprintf(&header, "<mbp:frameset>\n")
+
+	kw.volume = volume
+	kw.out = bufio.NewWriter(volume)
+	kw.volumeSize = int64(header.Len() + len(KINDLE_VOLUME_FOOTER))
+	kw.nentries = 0
+
+	if _, err := kw.out.WriteString(header.String()); err != nil {
+		volume.Close()
+		return errors.Wrap(err, "could not write volume")
+	}
+
+	return nil
+}
+
+// Finish the XHTML file of the current volume.
+func (kw *kindleWriter) closeVolume() error {
+	kw.out.WriteString(KINDLE_VOLUME_FOOTER)
+
+	if err := kw.out.Flush(); err != nil {
+		kw.volume.Close()
+		return errors.Wrap(err, "could not flush volume")
+	}
+
+	return kw.volume.Close()
+}
+
+// Write the OPF package of volume n.
+func (kw *kindleWriter) writePackage(n int) error {
+	title := kw.title
+
+	if kw.nvolumes > 1 {
+		title = fmt.Sprintf("%v, volume %v of %v", title, n, kw.nvolumes)
+	}
+
+	return writeFileWith(kw.volumePath(n, ".opf"), func(out *bufio.Writer) error {
+		fmt.Fprintf(out, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+		fmt.Fprintf(out, "<package version=\"2.0\" xmlns=\"http://www.idpf.org/2007/opf\" unique-identifier=\"uid\">\n")
+		fmt.Fprintf(out, "  <metadata xmlns:dc=\"http://purl.org/dc/elements/1.1/\">\n")
+		fmt.Fprintf(out, "    <dc:title>%v</dc:title>\n", xmlEscape(title))
+		fmt.Fprintf(out, "    <dc:creator>Wiktionary contributors</dc:creator>\n")
+		fmt.Fprintf(out, "    <dc:language>%v</dc:language>\n", LANGUAGE_CODE)
+		fmt.Fprintf(out, "    <dc:identifier id=\"uid\">%v:%v</dc:identifier>\n", xmlEscape(kw.identifier), n)
+		fmt.Fprintf(out, "    <dc:date>%v</dc:date>\n", xmlEscape(kw.createdOn))
+
+		if kw.copying != "" {
+			fmt.Fprintf(out, "    <dc:rights>%v</dc:rights>\n", xmlEscape(kw.copying))
+		}
+
+		fmt.Fprintf(out, "    <x-metadata>\n")
+		fmt.Fprintf(out, "      <DictionaryInLanguage>%v</DictionaryInLanguage>\n", LANGUAGE_CODE)
+		fmt.Fprintf(out, "      <DictionaryOutLanguage>%v</DictionaryOutLanguage>\n", LANGUAGE_CODE)
+		fmt.Fprintf(out, "      <DefaultLookupIndex>default</DefaultLookupIndex>\n")
+		fmt.Fprintf(out, "    </x-metadata>\n")
+		fmt.Fprintf(out, "  </metadata>\n")
+		fmt.Fprintf(out, "  <manifest>\n")
+		fmt.Fprintf(out, "    <item id=\"content\" href=\"%v\" media-type=\"application/xhtml+xml\"/>\n", xmlEscape(filepath.Base(kw.volumePath(n, ".xhtml"))))
+		fmt.Fprintf(out, "  </manifest>\n")
+		fmt.Fprintf(out, "  <spine>\n")
+		fmt.Fprintf(out, "    <itemref idref=\"content\"/>\n")
+		fmt.Fprintf(out, "  </spine>\n")
+		fmt.Fprintf(out, "</package>\n")
+
+		return nil
+	})
+}
+
+// Return the path of the file of volume n with the given extension.
+func (kw *kindleWriter) volumePath(n int, extension string) string {
+	return fmt.Sprintf("%v-%v%v", kw.basePath, n, extension)
+}
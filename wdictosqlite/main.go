@@ -5,8 +5,12 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kissen/wikidictools/wikidictools"
@@ -16,17 +20,51 @@ import (
 )
 
 type Arguments struct {
-	XmlFile   string
-	SqlFile   string
-	CreatedOn string
-	Copying   string
+	XmlFile    string
+	OutFile    string
+	Format     string
+	CreatedOn  string
+	Copying    string
+	Namespaces []string
+	IriBase    string
+	VolumeSize int
+
+	// Whether lookup keys of words have diacritics removed.
+	StripDiacritics bool
 }
 
 type ReferencesMap map[string]int64
 
+// Matches the date in the file names of Wikimedia dumps.
+var dumpDatePattern = regexp.MustCompile(`-(\d{4})(\d{2})(\d{2})-`)
+
+// Facts about an import gathered while filling the database.
+type ImportStats struct {
+	// Most recent revision timestamp of all imported pages.
+	LatestTimestamp string
+
+	// Time spent on reading the dump and inserting its contents.
+	Duration time.Duration
+}
+
+// Subcommands that may be given as the first argument. Without
+// a subcommand, wdictosqlite imports an XML dump.
+var subcommands = map[string]func(argv []string) error{
+	"anki":       RunAnki,
+	"complete":   RunComplete,
+	"migrate":    RunMigrate,
+	"query":      RunQuery,
+	"report":     RunReport,
+	"serve-dict": RunServeDict,
+	"serve":      RunServe,
+	"suggest":    RunSuggest,
+	"wordlist":   RunWordList,
+}
+
 func ParseArguments() Arguments {
 	var (
 		args       Arguments
+		namespaces string
 		printUsage bool
 	)
 
@@ -35,24 +73,36 @@ func ParseArguments() Arguments {
 	now := time.Now().UTC().Format(time.RFC3339)
 
 	flag.StringVar(&args.XmlFile, "infile", "--", "file from which to read XML or -- for stdin")
-	flag.StringVar(&args.SqlFile, "outfile", "", "file to write to, required")
+	flag.StringVar(&args.OutFile, "outfile", "", "file to write to, required")
+	flag.StringVar(&args.Format, "format", SQLITE_FORMAT, "output format, one of "+strings.Join(formatNames(), ", "))
 	flag.StringVar(&args.CreatedOn, "createdon", now, "overwrite timestamp embedded in created database")
 	flag.StringVar(&args.Copying, "copying", "", "copyright file to embed in database")
+	flag.StringVar(&namespaces, "namespaces", wikidictools.MAIN_NAMESPACE_NAME, "comma-separated list of namespaces to import pages from")
+	flag.StringVar(&args.IriBase, "iribase", "", "prefix of all IRIs in RDF output, defaults to a URN derived from the dump name")
+	flag.IntVar(&args.VolumeSize, "volumesize", 100, "maximum size of a single volume of e-book formats in MiB or 0 for no limit")
+	flag.BoolVar(&args.StripDiacritics, "stripdiacritics", false, "remove diacritics from the lookup keys of words")
 	flag.BoolVar(&printUsage, "help", false, "print help")
 
 	// Parse and validate.
 
 	flag.Parse()
 
-	if args.SqlFile == "" {
+	if args.OutFile == "" {
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	if _, ok := entryWriters[args.Format]; !ok && args.Format != SQLITE_FORMAT {
+		fmt.Fprintf(os.Stderr, "%v: unknown format %q\n", os.Args[0], args.Format)
+		os.Exit(1)
+	}
+
 	if args.Copying == "" {
 		fmt.Fprintf(os.Stderr, "%v: warning: missing -copying, not embedding copyright information\n", os.Args[0])
 	}
 
+	args.Namespaces = splitList(namespaces)
+
 	return args
 }
 
@@ -76,7 +126,7 @@ func CreateDatabaseFile(sqlFile string) error {
 	return nil
 }
 
-func OpenInputFileFrom(fileLocation string) (wikidictools.XmlParser, error) {
+func OpenInputFileFrom(fileLocation string, options wikidictools.XmlParserOptions) (wikidictools.XmlParser, error) {
 	var openedAFile bool
 	var rx io.ReadCloser
 
@@ -96,7 +146,7 @@ func OpenInputFileFrom(fileLocation string) (wikidictools.XmlParser, error) {
 		fmt.Fprintf(os.Stderr, "%v: opened %v for reading\n", os.Args[0], fileLocation)
 	}
 
-	parser, err := wikidictools.NewXmlParser(rx)
+	parser, err := wikidictools.NewXmlParserWithOptions(rx, options)
 	if err != nil {
 		if openedAFile {
 			rx.Close()
@@ -107,13 +157,15 @@ func OpenInputFileFrom(fileLocation string) (wikidictools.XmlParser, error) {
 	return parser, nil
 }
 
-func FillDatabase(dst *sql.DB, src wikidictools.XmlParser) (ReferencesMap, error) {
+func FillDatabase(dst *sql.DB, src wikidictools.XmlParser) (ReferencesMap, *ImportStats, error) {
 	nadded := 0
 	nreferences := make(ReferencesMap)
+	stats := ImportStats{}
+	started := time.Now()
 
 	tx, err := dst.Begin()
 	if err != nil {
-		return nil, errors.Wrap(err, "could not create transaction")
+		return nil, nil, errors.Wrap(err, "could not create transaction")
 	}
 
 	defer tx.Rollback()
@@ -127,9 +179,21 @@ func FillDatabase(dst *sql.DB, src wikidictools.XmlParser) (ReferencesMap, error
 			break
 		}
 
+		// Thesaurus pages are not words of their own. They only add synonym
+		// sets to other words.
+
+		if entry.Thesaurus != nil {
+			if err := InsertThesaurus(tx, entry.Thesaurus); err != nil {
+				return nil, nil, errors.Wrapf(err, "could not add thesaurus entry for word=%v", entry.Word)
+			}
+
+			continue
+		}
+
 		// Skip words without at least one definition associated with it.
+		// Reconstructed words are kept for their descendants.
 
-		if entry.IsEmpty() {
+		if entry.IsEmpty() && entry.Reconstruction == nil {
 			continue
 		}
 
@@ -137,7 +201,14 @@ func FillDatabase(dst *sql.DB, src wikidictools.XmlParser) (ReferencesMap, error
 		// individual definition.
 
 		if err := InsertDictionaryEntry(tx, entry); err != nil {
-			return nil, errors.Wrapf(err, "could not add entry for word=%v", entry.Word)
+			return nil, nil, errors.Wrapf(err, "could not add entry for word=%v", entry.Word)
+		}
+
+		// Timestamps are in RFC 3339 format and as such compare just like
+		// the times they represent.
+
+		if entry.Timestamp > stats.LatestTimestamp {
+			stats.LatestTimestamp = entry.Timestamp
 		}
 
 		// Ensure that we are tracking the word in memory.
@@ -164,15 +235,17 @@ func FillDatabase(dst *sql.DB, src wikidictools.XmlParser) (ReferencesMap, error
 	}
 
 	if err != nil && err != io.EOF {
-		return nil, errors.Wrap(err, "error while getting next XML entry")
+		return nil, nil, errors.Wrap(err, "error while getting next XML entry")
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, errors.Wrap(err, "could not commit")
+		return nil, nil, errors.Wrap(err, "could not commit")
 	}
 
+	stats.Duration = time.Since(started)
+
 	fmt.Fprintf(os.Stderr, "\n%v: done processing %v words for insertion\n", os.Args[0], nadded)
-	return nreferences, nil
+	return nreferences, &stats, nil
 }
 
 func FillInReferences(dst *sql.DB, nreferences ReferencesMap) error {
@@ -222,19 +295,69 @@ func FillInReferences(dst *sql.DB, nreferences ReferencesMap) error {
 	return nil
 }
 
-func WriteMetaData(dst *sql.DB, args *Arguments) (err error) {
-	if err = InsertMeta(dst, "CreatedOn", args.CreatedOn); err != nil {
-		return err
+// Write information about where the database came from into the meta
+// table. Counts are taken from the database, so call this after the
+// database was filled.
+func WriteMetaData(dst *sql.DB, args *Arguments, siteInfo wikidictools.SiteInfo, stats *ImportStats, nreferences ReferencesMap) (err error) {
+	nwords, err := queryInt(dst, `SELECT COUNT(*) FROM words;`)
+	if err != nil {
+		return errors.Wrap(err, "could not count words")
+	}
+
+	ndefinitions, err := queryInt(dst, `SELECT COUNT(*) FROM definitions;`)
+	if err != nil {
+		return errors.Wrap(err, "could not count definitions")
+	}
+
+	var nlinks int64
+
+	for _, count := range nreferences {
+		nlinks += count
+	}
+
+	meta := map[string]string{
+		"CreatedOn":       args.CreatedOn,
+		"SourceDbName":    siteInfo.DbName,
+		"SourceSiteName":  siteInfo.SiteName,
+		"LatestRevision":  stats.LatestTimestamp,
+		"ToolVersion":     ToolVersion(),
+		"ToolCommit":      ToolCommit(),
+		"WordCount":       strconv.FormatInt(nwords, 10),
+		"DefinitionCount": strconv.FormatInt(ndefinitions, 10),
+		"LinkCount":       strconv.FormatInt(nlinks, 10),
+		"Languages":       "English",
+		"Namespaces":      strings.Join(args.Namespaces, ","),
+		"ParseDuration":   stats.Duration.Round(time.Millisecond).String(),
+		"StripDiacritics": strconv.FormatBool(args.StripDiacritics),
+	}
+
+	// Wikimedia names dumps after the wiki and the date they were taken,
+	// e.g. "enwiktionary-20240301-pages-articles.xml".
+
+	if date, ok := dumpDateFrom(args.XmlFile); ok {
+		meta["SourceDumpDate"] = date
+	}
+
+	for key, value := range meta {
+		if err = SetMeta(dst, key, value); err != nil {
+			return errors.Wrapf(err, "could not set %v", key)
+		}
+	}
+
+	for _, namespace := range siteInfo.Namespaces {
+		if err = InsertNamespace(dst, namespace); err != nil {
+			return errors.Wrapf(err, "could not add namespace %v", namespace.Key)
+		}
 	}
 
 	if args.Copying != "" {
-		var contents []byte
+		var contents string
 
-		if contents, err = ioutil.ReadFile(args.Copying); err != nil {
-			return errors.Wrapf(err, "could not read file %v", args.Copying)
+		if contents, err = ReadCopying(args); err != nil {
+			return err
 		}
 
-		if err = InsertMeta(dst, "Copying", string(contents)); err != nil {
+		if err = SetMeta(dst, "Copying", contents); err != nil {
 			return errors.Wrap(err, "could not embed copyright information")
 		}
 	}
@@ -247,6 +370,29 @@ func exitBecauseOf(err error) {
 	os.Exit(1)
 }
 
+// Return the names of all supported output formats, sorted.
+func formatNames() []string {
+	names := []string{SQLITE_FORMAT}
+
+	for name := range entryWriters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Split comma-separated list s into its trimmed, non-empty elements.
+func splitList(s string) (elements []string) {
+	for _, element := range strings.Split(s, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+
+	return elements
+}
+
 // Increment m[key] by value. If m has no matching key, m[key] is set to value.
 func addOrIncrement(m map[string]int64, key string, value int64) {
 	if oldValue, ok := m[key]; ok {
@@ -257,29 +403,59 @@ func addOrIncrement(m map[string]int64, key string, value int64) {
 }
 
 func main() {
-	// Parse arguments.
+	// Dispatch to subcommand if one was given.
 
-	args := ParseArguments()
-
-	// Truncate and initalize schema in DB file.
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				exitBecauseOf(err)
+			}
 
-	if err := CreateDatabaseFile(args.SqlFile); err != nil {
-		exitBecauseOf(err)
+			return
+		}
 	}
 
+	// Parse arguments.
+
+	args := ParseArguments()
+
 	// Start reading XML.
 
-	xmlStream, err := OpenInputFileFrom(args.XmlFile)
+	xmlStream, err := OpenInputFileFrom(args.XmlFile, wikidictools.XmlParserOptions{
+		Namespaces:      args.Namespaces,
+		StripDiacritics: args.StripDiacritics,
+	})
 	if err != nil {
 		exitBecauseOf(err)
 	}
 
 	defer xmlStream.Close()
 
+	// Formats other than SQLite are written in a single pass.
+
+	if args.Format != SQLITE_FORMAT {
+		writer, err := entryWriters[args.Format](&args, xmlStream.SiteInfo())
+		if err != nil {
+			exitBecauseOf(err)
+		}
+
+		if err := ExportEntries(writer, xmlStream); err != nil {
+			exitBecauseOf(err)
+		}
+
+		return
+	}
+
+	// Truncate and initalize schema in DB file.
+
+	if err := CreateDatabaseFile(args.OutFile); err != nil {
+		exitBecauseOf(err)
+	}
+
 	// Prepare database connection we will use throughout
 	// this operation.
 
-	db, err := sql.Open("sqlite3", args.SqlFile)
+	db, err := sql.Open("sqlite3", args.OutFile)
 	if err != nil {
 		exitBecauseOf(err)
 	}
@@ -288,7 +464,7 @@ func main() {
 
 	// Fill the database. This is where most work gets done.
 
-	nreferences, err := FillDatabase(db, xmlStream)
+	nreferences, stats, err := FillDatabase(db, xmlStream)
 	if err != nil {
 		exitBecauseOf(err)
 	}
@@ -297,7 +473,31 @@ func main() {
 		exitBecauseOf(err)
 	}
 
-	if err := WriteMetaData(db, &args); err != nil {
+	if err := FillInScores(db); err != nil {
 		exitBecauseOf(err)
 	}
+
+	if err := LinkThesaurus(db); err != nil {
+		exitBecauseOf(err)
+	}
+
+	if err := BuildFullTextIndex(db); err != nil {
+		exitBecauseOf(err)
+	}
+
+	if err := WriteMetaData(db, &args, xmlStream.SiteInfo(), stats, nreferences); err != nil {
+		exitBecauseOf(err)
+	}
+}
+
+// Return the date in file name path of a Wikimedia dump, e.g. "2024-03-01"
+// for "enwiktionary-20240301-pages-articles.xml".
+func dumpDateFrom(path string) (string, bool) {
+	match := dumpDatePattern.FindStringSubmatch(filepath.Base(path))
+
+	if match == nil {
+		return "", false
+	}
+
+	return match[1] + "-" + match[2] + "-" + match[3], true
 }
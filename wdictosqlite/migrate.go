@@ -0,0 +1,52 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Upgrade a database file created by an older version of wdictosqlite
+// to the latest schema in place.
+func RunMigrate(argv []string) error {
+	var sqlFile string
+
+	flags := flag.NewFlagSet(os.Args[0]+" migrate", flag.ExitOnError)
+	flags.StringVar(&sqlFile, "db", "", "database file to upgrade, required")
+	flags.Parse(argv)
+
+	if sqlFile == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	// Refuse to work on files that do not exist. Otherwise the SQLite
+	// driver would happily create a new empty database for us.
+
+	if _, err := os.Stat(sqlFile); err != nil {
+		return errors.Wrap(err, "could not open database file")
+	}
+
+	db, err := sql.Open("sqlite3", sqlFile)
+	if err != nil {
+		return errors.Wrap(err, "could not open database")
+	}
+
+	defer db.Close()
+
+	from, to, err := MigrateDatabase(db)
+	if err != nil {
+		return err
+	}
+
+	if from == to {
+		fmt.Fprintf(os.Stderr, "%v: %v is already at schema version %v\n", os.Args[0], sqlFile, to)
+	} else {
+		fmt.Fprintf(os.Stderr, "%v: migrated %v from schema version %v to %v\n", os.Args[0], sqlFile, from, to)
+	}
+
+	return nil
+}
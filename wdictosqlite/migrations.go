@@ -0,0 +1,546 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Name of the key in the meta table that records the schema version of
+// a database file.
+const SCHEMA_VERSION_KEY = "schema_version"
+
+// A single step in the evolution of the database schema. Applying the
+// migration to a database at version-1 upgrades it to version.
+type migration struct {
+	version     int
+	description string
+	apply       func(tx *sql.Tx) error
+}
+
+// All migrations in order. The version of each entry must be exactly one
+// higher than the one before it. To change the schema, append a new entry;
+// never edit entries that were already released.
+//
+// Versions 2 to 14 were still changed and renumbered before they were
+// released and ship together in the first release with schema versioning.
+// No file exists at any of their earlier numbers.
+var migrations = []migration{
+	{1, "create words, definitions and meta tables", migrateToInitialSchema},
+	{2, "make key the primary key of meta", migrateToKeyedMeta},
+	{3, "record namespaces of words", migrateToNamespaces},
+	{4, "add reconstructions and their descendants", migrateToReconstructions},
+	{5, "add synonym sets from the thesaurus", migrateToThesaurus},
+	{6, "add parts of speech and full-text index", migrateToPartsOfSpeech},
+	{7, "add pronunciations", migrateToPronunciations},
+	{8, "add inflections, labels and proper nouns", migrateToInflections},
+	{9, "add sorted letters of words", migrateToLetters},
+	{10, "add phonetic keys", migrateToPhoneticKeys},
+	{11, "add deletion index for fuzzy lookups", migrateToDeleteVariants},
+	{12, "add folded words for autocompletion", migrateToFoldedWords},
+	{13, "add normalized lookup keys", migrateToLookupKeys},
+	{14, "add PageRank scores", migrateToScores},
+	{15, "add link targets of definitions", migrateToLinks},
+	{16, "compute PageRank scores over link targets", migrateToLinkScores},
+	{17, "add index on number of references", migrateToReferencesIndex},
+	{18, "add index on headwords of synonym sets", migrateToSynonymSetIndex},
+}
+
+// Return the schema version this version of wdictosqlite writes.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Return the schema version of the database. Returns 0 for a database
+// without any tables. Databases created before schema versioning was
+// introduced have no schema_version key in their meta table; those are
+// reported as version 1.
+func GetSchemaVersion(db Preparer) (int, error) {
+	hasMeta, err := hasTable(db, "meta")
+	if err != nil {
+		return 0, errors.Wrap(err, "could not look up meta table")
+	}
+
+	if !hasMeta {
+		return 0, nil
+	}
+
+	value, err := queryString(db, `SELECT value FROM meta WHERE key = $1;`, SCHEMA_VERSION_KEY)
+
+	if err == sql.ErrNoRows {
+		return 1, nil
+	}
+
+	if err != nil {
+		return 0, errors.Wrap(err, "could not read schema version")
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "bad schema version %q", value)
+	}
+
+	return version, nil
+}
+
+// Upgrade the database to the latest schema version. Each migration runs
+// in its own transaction, so a failure leaves the database at the last
+// version that was successfully applied. Returns the versions before and
+// after the upgrade.
+func MigrateDatabase(db *sql.DB) (from int, to int, err error) {
+	from, err = GetSchemaVersion(db)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if from > LatestSchemaVersion() {
+		return from, from, errors.Errorf(
+			"database has schema version %v but this tool only supports up to version %v",
+			from, LatestSchemaVersion(),
+		)
+	}
+
+	to = from
+
+	for _, m := range migrations {
+		if m.version <= from {
+			continue
+		}
+
+		if err := applyMigration(db, m); err != nil {
+			return from, to, errors.Wrapf(err, "migration to version %v (%v) failed", m.version, m.description)
+		}
+
+		to = m.version
+	}
+
+	return from, to, nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "could not start transaction")
+	}
+
+	if err := m.apply(tx); err != nil {
+		return rollbackBecauseOf(err, tx)
+	}
+
+	if err := setSchemaVersion(tx, m.version); err != nil {
+		return rollbackBecauseOf(err, tx)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "commit failed")
+	}
+
+	return nil
+}
+
+func setSchemaVersion(db Preparer, version int) error {
+	return SetMeta(db, SCHEMA_VERSION_KEY, strconv.Itoa(version))
+}
+
+func migrateToInitialSchema(tx *sql.Tx) error {
+	if err := createWordTable(tx); err != nil {
+		return err
+	}
+
+	if err := createWordIndex(tx); err != nil {
+		return err
+	}
+
+	if err := createDefintionTable(tx); err != nil {
+		return err
+	}
+
+	if err := createMetaTable(tx); err != nil {
+		return err
+	}
+
+	if err := createDefinitionsIndex(tx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func migrateToKeyedMeta(tx *sql.Tx) error {
+	// SQLite cannot add a primary key to an existing table, so we copy
+	// everything into a new table. If a key appears more than once, the
+	// value inserted last wins.
+
+	statements := []string{
+		`CREATE TABLE meta_keyed (
+			key TEXT NOT NULL PRIMARY KEY,
+			value TEXT NOT NULL
+		);`,
+		`INSERT OR REPLACE INTO meta_keyed(key, value) SELECT key, value FROM meta ORDER BY rowid;`,
+		`DROP TABLE meta;`,
+		`ALTER TABLE meta_keyed RENAME TO meta;`,
+	}
+
+	for _, statement := range statements {
+		if err := execute(tx, statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateToNamespaces(tx *sql.Tx) error {
+	// Databases created before this migration only contain words from
+	// the main namespace, so defaulting to 0 is correct for them.
+
+	if err := execute(tx, `ALTER TABLE words ADD COLUMN namespace INTEGER NOT NULL DEFAULT 0;`); err != nil {
+		return err
+	}
+
+	return createNamespaceTable(tx)
+}
+
+func migrateToReconstructions(tx *sql.Tx) error {
+	if err := createReconstructionTable(tx); err != nil {
+		return err
+	}
+
+	if err := createDescendantTable(tx); err != nil {
+		return err
+	}
+
+	return createDescendantIndices(tx)
+}
+
+func migrateToThesaurus(tx *sql.Tx) error {
+	if err := createSynonymSetTable(tx); err != nil {
+		return err
+	}
+
+	if err := createSynonymTable(tx); err != nil {
+		return err
+	}
+
+	return createThesaurusIndices(tx)
+}
+
+func migrateToPartsOfSpeech(tx *sql.Tx) error {
+	// We cannot know the part of speech of definitions imported before this
+	// migration. Those stay NULL.
+
+	if err := execute(tx, `ALTER TABLE definitions ADD COLUMN pos TEXT;`); err != nil {
+		return err
+	}
+
+	if err := createFullTextTable(tx); err != nil {
+		return err
+	}
+
+	return BuildFullTextIndex(tx)
+}
+
+func migrateToPronunciations(tx *sql.Tx) error {
+	// Pronunciations of words imported before this migration are not in
+	// the database; only a new import from the dump adds them.
+
+	if err := createPronunciationTable(tx); err != nil {
+		return err
+	}
+
+	return createPronunciationIndex(tx)
+}
+
+func migrateToInflections(tx *sql.Tx) error {
+	// As with pronunciations, inflections and labels of words imported
+	// before this migration are lost. No word is marked as proper noun.
+
+	if err := execute(tx, `ALTER TABLE words ADD COLUMN proper_noun BOOLEAN NOT NULL DEFAULT 0;`); err != nil {
+		return err
+	}
+
+	if err := createInflectionTable(tx); err != nil {
+		return err
+	}
+
+	if err := createLabelTable(tx); err != nil {
+		return err
+	}
+
+	return createInflectionIndices(tx)
+}
+
+func migrateToLetters(tx *sql.Tx) error {
+	// The sorted letters only depend on the word, so unlike other
+	// additions we can fill them in for existing words.
+
+	if err := execute(tx, `ALTER TABLE words ADD COLUMN letters TEXT;`); err != nil {
+		return err
+	}
+
+	if err := backfillWordColumn(tx, "letters", wikidictools.SortedLetters); err != nil {
+		return err
+	}
+
+	return createLettersIndex(tx)
+}
+
+func migrateToPhoneticKeys(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE words ADD COLUMN soundex TEXT;`,
+		`ALTER TABLE words ADD COLUMN metaphone TEXT;`,
+		`ALTER TABLE words ADD COLUMN metaphone_alt TEXT;`,
+		`ALTER TABLE words ADD COLUMN ipa_key TEXT;`,
+	}
+
+	for _, statement := range statements {
+		if err := execute(tx, statement); err != nil {
+			return err
+		}
+	}
+
+	if err := backfillWordColumn(tx, "soundex", wikidictools.Soundex); err != nil {
+		return err
+	}
+
+	err := backfillWordColumn(tx, "metaphone", func(word string) string {
+		primary, _ := wikidictools.DoubleMetaphone(word)
+		return primary
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = backfillWordColumn(tx, "metaphone_alt", func(word string) string {
+		_, alternate := wikidictools.DoubleMetaphone(word)
+		return alternate
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Words are keyed by their first pronunciation, if we know it.
+
+	sql := `SELECT word_id, pronunciation FROM pronunciations WHERE position = 0;`
+
+	if err := backfillColumn(tx, sql, "ipa_key", wikidictools.IpaKey); err != nil {
+		return err
+	}
+
+	return createPhoneticIndices(tx)
+}
+
+func migrateToDeleteVariants(tx *sql.Tx) error {
+	if err := createDeleteVariantTable(tx); err != nil {
+		return err
+	}
+
+	headwords, err := readHeadwords(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, headword := range headwords {
+		if err := insertDeleteVariants(tx, headword.id, headword.text); err != nil {
+			return errors.Wrapf(err, "could not insert delete variants for word=%v", headword.text)
+		}
+	}
+
+	return createDeleteVariantIndex(tx)
+}
+
+func migrateToFoldedWords(tx *sql.Tx) error {
+	if err := execute(tx, `ALTER TABLE words ADD COLUMN folded TEXT;`); err != nil {
+		return err
+	}
+
+	if err := backfillWordColumn(tx, "folded", wikidictools.FoldWord); err != nil {
+		return err
+	}
+
+	return createFoldedIndex(tx)
+}
+
+func migrateToLookupKeys(tx *sql.Tx) error {
+	if err := execute(tx, `ALTER TABLE words ADD COLUMN key TEXT;`); err != nil {
+		return err
+	}
+
+	// Existing files were created without -stripdiacritics.
+
+	err := backfillWordColumn(tx, "key", func(word string) string {
+		return wikidictools.NormalizeWord(word, false)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return createKeyIndex(tx)
+}
+
+func migrateToScores(tx *sql.Tx) error {
+	if err := execute(tx, `ALTER TABLE words ADD COLUMN score REAL NOT NULL DEFAULT 0;`); err != nil {
+		return err
+	}
+
+	if _, err := setScores(tx); err != nil {
+		return err
+	}
+
+	return createScoreIndex(tx)
+}
+
+func migrateToLinks(tx *sql.Tx) error {
+	if err := createLinkTable(tx); err != nil {
+		return err
+	}
+
+	// Stored definitions only kept the text of each link, which for most
+	// links is the target. It is the best we have.
+
+	definitions, err := readWordTexts(tx, `SELECT word_id, definition FROM definitions ORDER BY word_id, rowid;`)
+	if err != nil {
+		return errors.Wrap(err, "could not read definitions")
+	}
+
+	for _, definition := range definitions {
+		for _, target := range wikidictools.GetLinkTargetsFrom(definition.text) {
+			if err := insertLink(tx, definition.id, target); err != nil {
+				return errors.Wrapf(err, "could not insert link for word with id=%v", definition.id)
+			}
+		}
+	}
+
+	return createLinkIndex(tx)
+}
+
+func migrateToLinkScores(tx *sql.Tx) error {
+	_, err := setScores(tx)
+	return err
+}
+
+func migrateToReferencesIndex(tx *sql.Tx) error {
+	return createReferencesIndex(tx)
+}
+
+func migrateToSynonymSetIndex(tx *sql.Tx) error {
+	return createSynonymSetIndex(tx)
+}
+
+// A word ID together with some text about the word.
+type wordText struct {
+	id   int64
+	text string
+}
+
+// Set column of all rows in the words table to the result of compute on
+// their headword. For migrations that add columns derived from the word
+// alone. See wikidictools.DictionaryEntry.Headword.
+func backfillWordColumn(tx *sql.Tx, column string, compute func(word string) string) error {
+	headwords, err := readHeadwords(tx)
+	if err != nil {
+		return err
+	}
+
+	return setWordColumn(tx, column, headwords, compute)
+}
+
+// Run query, which returns the IDs of words and some text for each, and
+// set column of these words to the result of compute on the text.
+func backfillColumn(tx *sql.Tx, query string, column string, compute func(text string) string) error {
+	values, err := readWordTexts(tx, query)
+	if err != nil {
+		return errors.Wrapf(err, "could not read source of %v", column)
+	}
+
+	return setWordColumn(tx, column, values, compute)
+}
+
+// Return the headwords of all words. See
+// wikidictools.DictionaryEntry.Headword.
+func readHeadwords(tx *sql.Tx) ([]wordText, error) {
+	query := `
+		SELECT words.id, words.word, words.namespace, reconstructions.language, reconstructions.form
+		FROM words LEFT JOIN reconstructions ON reconstructions.word_id = words.id;`
+
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read words")
+	}
+
+	defer rows.Close()
+
+	var headwords []wordText
+
+	for rows.Next() {
+		var (
+			id             int64
+			entry          wikidictools.DictionaryEntry
+			language, form sql.NullString
+		)
+
+		if err := rows.Scan(&id, &entry.Word, &entry.Namespace, &language, &form); err != nil {
+			return nil, errors.Wrap(err, "could not read words")
+		}
+
+		if form.Valid {
+			entry.Reconstruction = &wikidictools.Reconstruction{
+				Language: language.String,
+				Form:     form.String,
+			}
+		}
+
+		headwords = append(headwords, wordText{id, entry.Headword()})
+	}
+
+	return headwords, errors.Wrap(rows.Err(), "could not read words")
+}
+
+// Return the IDs and texts returned by query.
+func readWordTexts(tx *sql.Tx, query string) ([]wordText, error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var values []wordText
+
+	for rows.Next() {
+		var value wordText
+
+		if err := rows.Scan(&value.id, &value.text); err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// Set column of each word in values to the result of compute on its text.
+// Empty results are stored as NULL. Read values completely before calling
+// this; SQLite does not like it if we update the table we are reading from.
+func setWordColumn(tx *sql.Tx, column string, values []wordText, compute func(text string) string) error {
+	statement, err := tx.Prepare(`UPDATE words SET ` + column + ` = $1 WHERE id = $2;`)
+	if err != nil {
+		return errors.Wrap(err, "could not prepare statement")
+	}
+
+	defer statement.Close()
+
+	for _, value := range values {
+		if _, err := statement.Exec(nullIfEmpty(compute(value.text)), value.id); err != nil {
+			return errors.Wrapf(err, "could not set %v of word with id=%v", column, value.id)
+		}
+	}
+
+	return nil
+}
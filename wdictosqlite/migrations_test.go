@@ -0,0 +1,268 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Every index of a database at the latest schema version.
+var latestIndices = []string{
+	"index_delete_variant",
+	"index_descendant",
+	"index_inflection_to_word_id",
+	"index_reconstruction_form",
+	"index_synonym_set",
+	"index_synonym_set_headword",
+	"index_synonym_set_headword_text",
+	"index_synonym_word",
+	"index_word_id_to_definition",
+	"index_word_id_to_descendant",
+	"index_word_id_to_inflection",
+	"index_word_id_to_label",
+	"index_word_id_to_link",
+	"index_word_id_to_pronunciation",
+	"index_words",
+	"index_words_folded",
+	"index_words_ipa_key",
+	"index_words_key",
+	"index_words_letters",
+	"index_words_metaphone",
+	"index_words_metaphone_alt",
+	"index_words_nreferences",
+	"index_words_score",
+	"index_words_soundex",
+}
+
+// Columns that migrations fill in for existing words.
+type migratedWord struct {
+	letters      string
+	soundex      string
+	metaphone    string
+	metaphoneAlt string
+	key          string
+}
+
+func TestMigrateDatabaseFromVersion1(t *testing.T) {
+	db := openTestDatabase(t)
+
+	// Files from before schema versioning have the initial tables but no
+	// schema_version key.
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateToInitialSchema(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	executeAll(t, db,
+		`INSERT INTO words(id, word, revision, nreferences) VALUES (1, 'Smith', 1, 0);`,
+		`INSERT INTO words(id, word, revision, nreferences) VALUES (2, 'worker', 2, 1);`,
+		`INSERT INTO words(id, word, revision, nreferences) VALUES (3, 'metal', 3, 2);`,
+		`INSERT INTO definitions(word_id, definition) VALUES (1, 'A [[worker]] in [[metal]].');`,
+		`INSERT INTO definitions(word_id, definition) VALUES (2, 'One who works with [[metal]].');`,
+		`INSERT INTO definitions(word_id, definition) VALUES (3, 'A shiny material.');`,
+		`INSERT INTO meta(key, value) VALUES ('title', 'old');`,
+		`INSERT INTO meta(key, value) VALUES ('title', 'new');`,
+	)
+
+	migrateTestDatabase(t, db, 1)
+
+	checkMigratedWord(t, db, 1, migratedWord{"himst", "S530", "SM0", "XMT", "smith"})
+	checkMigratedWord(t, db, 3, migratedWord{"aelmt", "M340", "MTL", "MTL", "metal"})
+
+	// The value inserted last wins when meta gets its primary key.
+
+	title, err := queryString(db, `SELECT value FROM meta WHERE key = 'title';`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if title != "new" {
+		t.Errorf("got title %q, expected %q", title, "new")
+	}
+
+	checkLinks(t, db, 1, []string{"worker", "metal"})
+
+	// Everything links to metal and nothing links to Smith.
+
+	if smith, metal := queryScore(t, db, 1), queryScore(t, db, 3); !(metal > smith && smith > 0) {
+		t.Errorf("got scores %v for Smith and %v for metal, expected 0 < Smith < metal", smith, metal)
+	}
+
+	checkIndices(t, db)
+}
+
+func TestMigrateDatabaseFromVersion6(t *testing.T) {
+	db := openTestDatabase(t)
+
+	for _, m := range migrations[:6] {
+		if err := applyMigration(db, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	executeAll(t, db,
+		`INSERT INTO words(id, word, revision, namespace) VALUES (1, 'wolf', 1, 0);`,
+		`INSERT INTO words(id, word, revision, namespace) VALUES (2, 'dog', 2, 0);`,
+		`INSERT INTO words(id, word, revision, namespace) VALUES (3, 'Reconstruction:Proto-Germanic/wulfaz', 3, 118);`,
+		`INSERT INTO reconstructions(word_id, language, form) VALUES (3, 'Proto-Germanic', 'wulfaz');`,
+		`INSERT INTO definitions(word_id, pos, definition) VALUES (1, 'noun', 'A wild [[dog]].');`,
+		`INSERT INTO definitions(word_id, pos, definition) VALUES (2, 'noun', 'An [[animal]] like a [[wolf|wolf]].');`,
+		`INSERT INTO definitions(word_id, pos, definition) VALUES (3, 'noun', '[[wolf]]');`,
+	)
+
+	migrateTestDatabase(t, db, 6)
+
+	// Reconstructions are keyed by their form, not the title of their page.
+	// The w makes Double Metaphone read the final z as ts in the alternate
+	// key.
+
+	checkMigratedWord(t, db, 1, migratedWord{"flow", "W410", "ALF", "FLF", "wolf"})
+	checkMigratedWord(t, db, 3, migratedWord{"afluwz", "W412", "ALFS", "FLFT", "wulfaz"})
+
+	nvariants, err := queryInt(db, `SELECT COUNT(*) FROM delete_variants WHERE word_id = 3 AND variant = 'wulfaz';`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nvariants != 1 {
+		t.Errorf("got %v delete variants wulfaz for the reconstruction, expected 1", nvariants)
+	}
+
+	checkLinks(t, db, 2, []string{"animal", "wolf"})
+
+	if dog := queryScore(t, db, 2); dog <= 0 {
+		t.Errorf("got score %v for dog, expected a positive score", dog)
+	}
+
+	checkIndices(t, db)
+}
+
+// Return an empty database in a temporary directory.
+func openTestDatabase(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db
+}
+
+func executeAll(t *testing.T, db *sql.DB, statements ...string) {
+	for _, statement := range statements {
+		if err := execute(db, statement); err != nil {
+			t.Fatalf("%v: %v", statement, err)
+		}
+	}
+}
+
+// Migrate db, which is at version from, and check that it ends up at the
+// latest version.
+func migrateTestDatabase(t *testing.T, db *sql.DB, from int) {
+	migratedFrom, migratedTo, err := MigrateDatabase(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if migratedFrom != from || migratedTo != LatestSchemaVersion() {
+		t.Errorf("migrated from %v to %v, expected %v to %v", migratedFrom, migratedTo, from, LatestSchemaVersion())
+	}
+
+	version, err := GetSchemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != LatestSchemaVersion() {
+		t.Errorf("got schema version %v after migrating, expected %v", version, LatestSchemaVersion())
+	}
+}
+
+func checkMigratedWord(t *testing.T, db *sql.DB, id int64, expected migratedWord) {
+	var got migratedWord
+
+	query := `SELECT letters, soundex, metaphone, metaphone_alt, key FROM words WHERE id = $1;`
+	err := db.QueryRow(query, id).Scan(&got.letters, &got.soundex, &got.metaphone, &got.metaphoneAlt, &got.key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != expected {
+		t.Errorf("got columns %+v for word with id=%v, expected %+v", got, id, expected)
+	}
+}
+
+func checkLinks(t *testing.T, db *sql.DB, id int64, expected []string) {
+	rows, err := db.Query(`SELECT target FROM links WHERE word_id = $1 ORDER BY rowid;`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	var targets []string
+
+	for rows.Next() {
+		var target string
+
+		if err := rows.Scan(&target); err != nil {
+			t.Fatal(err)
+		}
+
+		targets = append(targets, target)
+	}
+
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("got links %v for word with id=%v, expected %v", targets, id, expected)
+	}
+}
+
+func checkIndices(t *testing.T, db *sql.DB) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'index' AND sql IS NOT NULL;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	var indices []string
+
+	for rows.Next() {
+		var name string
+
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+
+		indices = append(indices, name)
+	}
+
+	sort.Strings(indices)
+
+	if !reflect.DeepEqual(indices, latestIndices) {
+		t.Errorf("got indices %v, expected %v", indices, latestIndices)
+	}
+}
+
+func queryScore(t *testing.T, db *sql.DB, id int64) (score float64) {
+	if err := db.QueryRow(`SELECT score FROM words WHERE id = $1;`, id).Scan(&score); err != nil {
+		t.Fatal(err)
+	}
+
+	return score
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Vocabularies used in OntoLex-Lemon output, keyed by their usual prefix.
+var ontolexPrefixes = []struct {
+	prefix string
+	iri    string
+}{
+	{"rdf", "http://www.w3.org/1999/02/22-rdf-syntax-ns#"},
+	{"rdfs", "http://www.w3.org/2000/01/rdf-schema#"},
+	{"skos", "http://www.w3.org/2004/02/skos/core#"},
+	{"dct", "http://purl.org/dc/terms/"},
+	{"ontolex", "http://www.w3.org/ns/lemon/ontolex#"},
+	{"lime", "http://www.w3.org/ns/lemon/lime#"},
+	{"lexinfo", "http://www.lexinfo.net/ontology/3.0/lexinfo#"},
+}
+
+// Values of lexinfo:partOfSpeech. Phrases have no such value.
+var ontolexPartsOfSpeech = map[string]string{
+	"noun":      "lexinfo:noun",
+	"verb":      "lexinfo:verb",
+	"adjective": "lexinfo:adjective",
+	"adverb":    "lexinfo:adverb",
+}
+
+// Writes OntoLex-Lemon RDF, either as N-Triples or as Turtle. Every part of
+// speech of a word becomes an ontolex:LexicalEntry with one
+// ontolex:LexicalSense per definition. IRIs only depend on the word, the
+// part of speech and the index of the sense, so they stay the same between
+// dumps as long as the definitions keep their order.
+//
+// Links in definitions become rdfs:seeAlso from the sense to the linked
+// word. Each word in turn points to its entries with rdfs:seeAlso.
+type ontolexWriter struct {
+	file io.WriteCloser
+	out  *bufio.Writer
+
+	// Whether to write Turtle. Otherwise we write N-Triples.
+	turtle bool
+
+	// Prefix of all IRIs we mint.
+	base string
+
+	// First error encountered while writing triples, if any.
+	err error
+}
+
+func NewNTriplesWriter(args *Arguments, siteInfo wikidictools.SiteInfo) (EntryWriter, error) {
+	return newOntolexWriter(args, siteInfo, false)
+}
+
+func NewTurtleWriter(args *Arguments, siteInfo wikidictools.SiteInfo) (EntryWriter, error) {
+	return newOntolexWriter(args, siteInfo, true)
+}
+
+func newOntolexWriter(args *Arguments, siteInfo wikidictools.SiteInfo, turtle bool) (EntryWriter, error) {
+	copying, err := ReadCopying(args)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := OpenOutputFile(args.OutFile)
+	if err != nil {
+		return nil, err
+	}
+
+	created := &ontolexWriter{
+		file:   file,
+		out:    bufio.NewWriter(file),
+		turtle: turtle,
+		base:   args.IriBase,
+	}
+
+	if created.base == "" {
+		created.base = "urn:wikidictools:" + url.PathEscape(siteInfo.DbName) + ":"
+	}
+
+	if turtle {
+		for _, prefix := range ontolexPrefixes {
+			fmt.Fprintf(created.out, "@prefix %v: <%v> .\n", prefix.prefix, prefix.iri)
+		}
+
+		created.out.WriteString("\n")
+	}
+
+	lexicon := created.iri(created.lexiconIri())
+
+	created.triple(lexicon, "rdf:type", "lime:Lexicon")
+	created.triple(lexicon, "rdfs:label", created.literal(DictionaryTitle(siteInfo), ""))
+	created.triple(lexicon, "dct:created", created.literal(args.CreatedOn, ""))
+	created.triple(lexicon, "dct:source", created.literal(siteInfo.Base, ""))
+	created.triple(lexicon, "lime:language", created.literal(LANGUAGE_CODE, ""))
+
+	if copying != "" {
+		created.triple(lexicon, "dct:rights", created.literal(strings.TrimSpace(copying), ""))
+	}
+
+	if created.err != nil {
+		file.Close()
+		return nil, created.err
+	}
+
+	return created, nil
+}
+
+func (ow *ontolexWriter) WriteEntry(entry *wikidictools.DictionaryEntry) error {
+	if entry.IsEmpty() {
+		return nil
+	}
+
+	// Reconstructed words are written the way etymologists write them,
+	// with an asterisk. Their language is not one of ours.
+
+	writtenRep, language := entry.Word, LANGUAGE_CODE
+
+	if entry.Reconstruction != nil {
+		writtenRep, language = "*"+entry.Reconstruction.Form, ""
+	}
+
+	// IPA gets its own language subtag.
+
+	phoneticLanguage := ""
+
+	if language != "" {
+		phoneticLanguage = language + "-fonipa"
+	}
+
+	entryType := "ontolex:Word"
+
+	if strings.ContainsRune(entry.Word, ' ') {
+		entryType = "ontolex:MultiwordExpression"
+	}
+
+	word := ow.iri(ow.wordIri(entry.Word))
+
+	ow.triple(word, "rdfs:label", ow.literal(entry.Word, language))
+
+	entry.ForEachPartOfSpeech(func(partOfSpeech string, definitions []string) bool {
+		base := ow.entryIri(entry.Word, partOfSpeech)
+
+		lexicalEntry := ow.iri(base)
+		form := ow.iri(base + "/form")
+
+		ow.triple(ow.iri(ow.lexiconIri()), "lime:entry", lexicalEntry)
+		ow.triple(word, "rdfs:seeAlso", lexicalEntry)
+
+		ow.triple(lexicalEntry, "rdf:type", "ontolex:LexicalEntry")
+		ow.triple(lexicalEntry, "rdf:type", entryType)
+		ow.triple(lexicalEntry, "rdfs:label", ow.literal(writtenRep, language))
+		ow.triple(lexicalEntry, "ontolex:canonicalForm", form)
+
+		if pos, ok := ontolexPartsOfSpeech[partOfSpeech]; ok {
+			ow.triple(lexicalEntry, "lexinfo:partOfSpeech", pos)
+		}
+
+		ow.triple(form, "rdf:type", "ontolex:Form")
+		ow.triple(form, "ontolex:writtenRep", ow.literal(writtenRep, language))
+
+		for _, pronunciation := range entry.Pronunciations {
+			ow.triple(form, "ontolex:phoneticRep", ow.literal(pronunciation, phoneticLanguage))
+		}
+
+		for i, alternative := range entry.AlternativeForms {
+			otherForm := ow.iri(fmt.Sprintf("%v/form/%v", base, i+1))
+
+			ow.triple(lexicalEntry, "ontolex:otherForm", otherForm)
+			ow.triple(otherForm, "rdf:type", "ontolex:Form")
+			ow.triple(otherForm, "ontolex:writtenRep", ow.literal(alternative, language))
+		}
+
+		for i, definition := range definitions {
+			sense := ow.iri(fmt.Sprintf("%v/sense/%v", base, i+1))
+
+			ow.triple(lexicalEntry, "ontolex:sense", sense)
+			ow.triple(sense, "rdf:type", "ontolex:LexicalSense")
+			ow.triple(sense, "skos:definition", ow.literal(wikidictools.StripLinksFrom(definition), language))
+
+			for _, link := range wikidictools.GetLinksFrom(definition) {
+				target, _, _ := strings.Cut(link, "|")
+				ow.triple(sense, "rdfs:seeAlso", ow.iri(ow.wordIri(target)))
+			}
+		}
+
+		return ow.err == nil
+	})
+
+	return ow.err
+}
+
+func (ow *ontolexWriter) Close() error {
+	if ow.err != nil {
+		ow.file.Close()
+		return ow.err
+	}
+
+	if err := ow.out.Flush(); err != nil {
+		ow.file.Close()
+		return errors.Wrap(err, "could not flush output")
+	}
+
+	return ow.file.Close()
+}
+
+// Write a single triple. Arguments are IRIs in angle brackets, prefixed
+// names like "rdf:type" or literals as returned by literal. The first
+// error is kept in ow.err; after that, triple does nothing.
+func (ow *ontolexWriter) triple(subject, predicate, object string) {
+	if ow.err != nil {
+		return
+	}
+
+	terms := []string{subject, predicate, object}
+
+	for i, term := range terms {
+		expanded, err := ow.expand(term)
+
+		if err != nil {
+			ow.err = err
+			return
+		}
+
+		terms[i] = expanded
+	}
+
+	fmt.Fprintf(ow.out, "%v %v %v .\n", terms[0], terms[1], terms[2])
+}
+
+// Return term as written to the output. N-Triples has no prefixed names,
+// so there we replace them by the full IRI.
+func (ow *ontolexWriter) expand(term string) (string, error) {
+	if ow.turtle || strings.HasPrefix(term, "<") || strings.HasPrefix(term, "\"") {
+		return term, nil
+	}
+
+	prefix, local, _ := strings.Cut(term, ":")
+
+	for _, candidate := range ontolexPrefixes {
+		if candidate.prefix == prefix {
+			return "<" + candidate.iri + local + ">", nil
+		}
+	}
+
+	return "", errors.Errorf("unknown prefix in %v", term)
+}
+
+// Return the IRI of the lexicon without angle brackets.
+func (ow *ontolexWriter) lexiconIri() string {
+	return ow.base + "lexicon"
+}
+
+// Return the IRI of word without angle brackets. Links in definitions
+// point here.
+func (ow *ontolexWriter) wordIri(word string) string {
+	return ow.base + "word/" + url.PathEscape(word)
+}
+
+// Return the IRI of the lexical entry of word with the given part of
+// speech, without angle brackets.
+func (ow *ontolexWriter) entryIri(word, partOfSpeech string) string {
+	return ow.base + "entry/" + url.PathEscape(word) + "/" + partOfSpeech
+}
+
+// Return iri in angle brackets.
+func (ow *ontolexWriter) iri(iri string) string {
+	return "<" + iri + ">"
+}
+
+// Return text as a quoted literal with the given language tag. If
+// language is empty, the literal is a plain string.
+func (ow *ontolexWriter) literal(text, language string) string {
+	escaped := strings.NewReplacer(
+		"\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\r", "\\r",
+	).Replace(text)
+
+	if language == "" {
+		return "\"" + escaped + "\""
+	}
+
+	return "\"" + escaped + "\"@" + language
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Probability that a reader of the dictionary follows a link in a
+// definition instead of jumping to a random word.
+const PAGERANK_DAMPING = 0.85
+
+// PageRank stops after this many iterations even if the scores still
+// change.
+const PAGERANK_MAX_ITERATIONS = 100
+
+// PageRank stops once the scores of all words change by less than this
+// in sum.
+const PAGERANK_TOLERANCE = 1e-6
+
+// The graph of links between words. Word i links to word targets[j] for
+// all j in [offsets[i], offsets[i+1]).
+type linkGraph struct {
+	ids     []int64
+	offsets []int
+	targets []int32
+}
+
+// Compute the PageRank of all words over the links in their definitions
+// and store it in the score column. Only call this once all words have
+// been inserted.
+func FillInScores(dst *sql.DB) error {
+	tx, err := dst.Begin()
+	if err != nil {
+		return errors.Wrap(err, "could not start transaction")
+	}
+
+	defer tx.Rollback()
+
+	niterations, err := setScores(tx)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "could not commit")
+	}
+
+	fmt.Fprintf(os.Stderr, "%v: done computing scores in %v iterations\n", os.Args[0], niterations)
+	return nil
+}
+
+// Compute and store the PageRank of all words. Returns the number of
+// iterations it took.
+func setScores(tx *sql.Tx) (int, error) {
+	graph, err := readLinkGraph(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	scores, niterations := graph.pageRank()
+
+	statement, err := tx.Prepare(`UPDATE words SET score = $1 WHERE id = $2;`)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not prepare statement")
+	}
+
+	defer statement.Close()
+
+	for i, id := range graph.ids {
+		if _, err := statement.Exec(scores[i], id); err != nil {
+			return 0, errors.Wrapf(err, "could not set score of word with id=%v", id)
+		}
+	}
+
+	return niterations, nil
+}
+
+// Read the links between all words. Links to words that are not in the
+// database and links of words to themselves are left out.
+func readLinkGraph(tx *sql.Tx) (*linkGraph, error) {
+	graph := &linkGraph{}
+	indices := make(map[string]int32)
+	idIndices := make(map[int64]int32)
+
+	rows, err := tx.Query(`SELECT id, word FROM words ORDER BY id;`)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read words")
+	}
+
+	for rows.Next() {
+		var (
+			id   int64
+			word string
+		)
+
+		if err := rows.Scan(&id, &word); err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "could not read words")
+		}
+
+		indices[word] = int32(len(graph.ids))
+		idIndices[id] = int32(len(graph.ids))
+		graph.ids = append(graph.ids, id)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read words")
+	}
+
+	// Links come in no particular order, so we collect the links of each
+	// word first and pack them into a single slice later.
+
+	links := make([][]int32, len(graph.ids))
+
+	err = forEachLinkTarget(tx, func(wordId int64, link string) {
+		source, ok := idIndices[wordId]
+		if !ok {
+			return
+		}
+
+		if target, ok := indices[link]; ok && target != source {
+			links[source] = append(links[source], target)
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	graph.offsets = make([]int, 0, len(links)+1)
+
+	for _, targets := range links {
+		graph.offsets = append(graph.offsets, len(graph.targets))
+		graph.targets = append(graph.targets, targets...)
+	}
+
+	graph.offsets = append(graph.offsets, len(graph.targets))
+
+	return graph, nil
+}
+
+// Run f on the ID of each word with the target of each of its links.
+// Files before schema version 15 have no links table; for those, we take
+// the texts of the links in definitions just like migration 15 does.
+func forEachLinkTarget(tx *sql.Tx, f func(wordId int64, target string)) error {
+	hasLinks, err := hasTable(tx, "links")
+	if err != nil {
+		return errors.Wrap(err, "could not look up links table")
+	}
+
+	query := `SELECT word_id, definition FROM definitions;`
+	targets := wikidictools.GetLinkTargetsFrom
+
+	if hasLinks {
+		query = `SELECT word_id, target FROM links;`
+		targets = func(target string) []string { return []string{target} }
+	}
+
+	rows, err := tx.Query(query)
+	if err != nil {
+		return errors.Wrap(err, "could not read links")
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			wordId int64
+			text   string
+		)
+
+		if err := rows.Scan(&wordId, &text); err != nil {
+			return errors.Wrap(err, "could not read links")
+		}
+
+		for _, target := range targets(text) {
+			f(wordId, target)
+		}
+	}
+
+	return errors.Wrap(rows.Err(), "could not read links")
+}
+
+// Return the PageRank of each word, scaled so that the average word has
+// a score of 1, together with the number of iterations it took. A word
+// linked to by many words with high scores gets a high score itself.
+func (g *linkGraph) pageRank() ([]float64, int) {
+	n := len(g.ids)
+
+	if n == 0 {
+		return nil, 0
+	}
+
+	scores := make([]float64, n)
+	next := make([]float64, n)
+
+	for i := range scores {
+		scores[i] = 1 / float64(n)
+	}
+
+	niterations := 0
+
+	for niterations < PAGERANK_MAX_ITERATIONS {
+		niterations += 1
+
+		// Words without links pass on their score to all words
+		// alike, just like random jumps do.
+
+		dangling := 0.0
+
+		for i := 0; i < n; i++ {
+			if g.offsets[i] == g.offsets[i+1] {
+				dangling += scores[i]
+			}
+		}
+
+		base := (1-PAGERANK_DAMPING)/float64(n) + PAGERANK_DAMPING*dangling/float64(n)
+
+		for i := range next {
+			next[i] = base
+		}
+
+		for i := 0; i < n; i++ {
+			targets := g.targets[g.offsets[i]:g.offsets[i+1]]
+
+			if len(targets) == 0 {
+				continue
+			}
+
+			share := PAGERANK_DAMPING * scores[i] / float64(len(targets))
+
+			for _, target := range targets {
+				next[target] += share
+			}
+		}
+
+		change := 0.0
+
+		for i := range scores {
+			change += math.Abs(next[i] - scores[i])
+		}
+
+		scores, next = next, scores
+
+		if change < PAGERANK_TOLERANCE {
+			break
+		}
+	}
+
+	for i := range scores {
+		scores[i] *= float64(n)
+	}
+
+	return scores, niterations
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictdb"
+	"github.com/pkg/errors"
+)
+
+// Print all words of a database that match the given criteria, one per
+// line and by default in byte order. Meant for word games and crosswords.
+func RunQuery(argv []string) error {
+	var (
+		sqlFile       string
+		outFile       string
+		expression    string
+		partsOfSpeech string
+		phonetic      string
+		order         string
+		limit         int
+		query         wikidictdb.WordQuery
+	)
+
+	flags := flag.NewFlagSet(os.Args[0]+" query", flag.ExitOnError)
+	flags.StringVar(&sqlFile, "db", "", "database file to read, required")
+	flags.StringVar(&outFile, "outfile", "--", "file to write to or -- for stdout")
+	flags.StringVar(&query.Pattern, "pattern", "", "pattern the word has to match, ? for any single character and * for any number of characters")
+	flags.StringVar(&expression, "regexp", "", "regular expression the word has to match")
+	flags.IntVar(&query.MinLength, "minlength", 0, "minimum length of the word in characters")
+	flags.IntVar(&query.MaxLength, "maxlength", 0, "maximum length of the word in characters")
+	flags.StringVar(&partsOfSpeech, "pos", "", "comma-separated parts of speech, e.g. noun,verb; the word needs a definition of at least one")
+	flags.BoolVar(&query.NoProperNouns, "noproper", false, "leave out proper nouns")
+	flags.Int64Var(&query.MinReferences, "minreferences", 0, "leave out words with fewer links to them")
+	flags.StringVar(&query.Anagram, "anagram", "", "only print anagrams of this word")
+	flags.StringVar(&query.SoundsLike, "soundslike", "", "only print words that sound like this word")
+	flags.StringVar(&phonetic, "phonetic", "metaphone", "phonetic key for -soundslike, one of soundex, metaphone, ipa")
+	flags.StringVar(&order, "sort", "word", "order of the words, one of word, references, score")
+	flags.IntVar(&limit, "limit", 0, "maximum number of words to print or 0 for no limit")
+	flags.Parse(argv)
+
+	if sqlFile == "" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if expression != "" {
+		compiled, err := regexp.Compile(expression)
+		if err != nil {
+			return errors.Wrap(err, "bad regular expression")
+		}
+
+		query.Regexp = compiled
+	}
+
+	key, ok := wikidictdb.PhoneticKeyNamed(phonetic)
+	if !ok {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	query.Phonetic = key
+
+	if query.Order, ok = wikidictdb.WordOrderNamed(order); !ok {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if partsOfSpeech != "" {
+		query.PartsOfSpeech = strings.Split(partsOfSpeech, ",")
+	}
+
+	db, err := wikidictdb.Open(sqlFile)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	file, err := OpenOutputFile(outFile)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(file)
+	nwritten := 0
+
+	err = db.FindWords(&query, func(word wikidictdb.Word) bool {
+		fmt.Fprintf(out, "%v\n", word.Word)
+		nwritten += 1
+
+		return limit == 0 || nwritten < limit
+	})
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := out.Flush(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "could not flush output")
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictdb"
+	"github.com/pkg/errors"
+)
+
+// A link target that is not a word of the database.
+type danglingLink struct {
+	Target string `json:"target"`
+
+	// Number of links to the target.
+	Count int64 `json:"count"`
+
+	// Words with links to the target, in byte order.
+	Sources []string `json:"sources"`
+}
+
+// A word no other word links to.
+type orphanWord struct {
+	Word string `json:"word"`
+}
+
+// Write a report about the links between the words of a database for
+// quality checks: either all link targets that are not words of the
+// database or all words without links from other words.
+func RunReport(argv []string) error {
+	var (
+		sqlFile    string
+		outFile    string
+		format     string
+		list       string
+		maxSources int
+	)
+
+	flags := flag.NewFlagSet(os.Args[0]+" report", flag.ExitOnError)
+	flags.StringVar(&sqlFile, "db", "", "database file to read, required")
+	flags.StringVar(&outFile, "outfile", "--", "file to write to or -- for stdout")
+	flags.StringVar(&format, "format", "csv", "output format, one of csv, json")
+	flags.StringVar(&list, "list", "dangling", "what to list, one of dangling (link targets that are not words), orphans (words without links to them)")
+	flags.IntVar(&maxSources, "maxsources", 0, "maximum number of source words to list per dangling link or 0 for no limit")
+	flags.Parse(argv)
+
+	if sqlFile == "" || (format != "csv" && format != "json") || (list != "dangling" && list != "orphans") {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	db, err := wikidictdb.Open(sqlFile)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	dangling, orphans, err := analyzeLinks(db, maxSources)
+	if err != nil {
+		return err
+	}
+
+	file, err := OpenOutputFile(outFile)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(file)
+
+	if list == "dangling" {
+		err = writeDanglingLinks(out, format, dangling)
+	} else {
+		err = writeOrphanWords(out, format, orphans)
+	}
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := out.Flush(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "could not flush output")
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if list == "dangling" {
+		fmt.Fprintf(os.Stderr, "%v: found %v dangling link targets\n", os.Args[0], len(dangling))
+	} else {
+		fmt.Fprintf(os.Stderr, "%v: found %v orphan words\n", os.Args[0], len(orphans))
+	}
+
+	return nil
+}
+
+// Return all link targets that are not words of db, most linked first,
+// together with all words that no other word links to, in byte order.
+// Links of words to themselves do not count.
+func analyzeLinks(db *wikidictdb.Database, maxSources int) ([]danglingLink, []orphanWord, error) {
+	linked := make(map[string]bool)
+
+	err := db.ForEachWord(func(word wikidictdb.Word) bool {
+		linked[word.Word] = false
+		return true
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targets := make(map[string]*danglingLink)
+
+	err = db.ForEachLink(func(source, target string) bool {
+		if isLinked, ok := linked[target]; ok {
+			if !isLinked && target != source {
+				linked[target] = true
+			}
+
+			return true
+		}
+
+		link, ok := targets[target]
+
+		if !ok {
+			link = &danglingLink{Target: target}
+			targets[target] = link
+		}
+
+		link.Count += 1
+
+		// Sources come in order, so duplicates are next to each other.
+
+		if n := len(link.Sources); n > 0 && link.Sources[n-1] == source {
+			return true
+		}
+
+		if maxSources == 0 || len(link.Sources) < maxSources {
+			link.Sources = append(link.Sources, source)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dangling := make([]danglingLink, 0, len(targets))
+
+	for _, link := range targets {
+		dangling = append(dangling, *link)
+	}
+
+	sort.Slice(dangling, func(i, j int) bool {
+		if dangling[i].Count != dangling[j].Count {
+			return dangling[i].Count > dangling[j].Count
+		}
+
+		return dangling[i].Target < dangling[j].Target
+	})
+
+	orphans := []orphanWord{}
+
+	for word, isLinked := range linked {
+		if !isLinked {
+			orphans = append(orphans, orphanWord{Word: word})
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Word < orphans[j].Word
+	})
+
+	return dangling, orphans, nil
+}
+
+// Write dangling links as CSV with a header or as JSON array. In CSV, the
+// source words are separated by "|", which MediaWiki does not allow in
+// page titles.
+func writeDanglingLinks(out *bufio.Writer, format string, dangling []danglingLink) error {
+	if format == "json" {
+		return writeJsonReport(out, dangling)
+	}
+
+	records := [][]string{{"target", "count", "sources"}}
+
+	for _, link := range dangling {
+		records = append(records, []string{
+			link.Target, strconv.FormatInt(link.Count, 10), strings.Join(link.Sources, "|"),
+		})
+	}
+
+	return writeCsvReport(out, records)
+}
+
+// Write orphan words as CSV with a header or as JSON array.
+func writeOrphanWords(out *bufio.Writer, format string, orphans []orphanWord) error {
+	if format == "json" {
+		return writeJsonReport(out, orphans)
+	}
+
+	records := [][]string{{"word"}}
+
+	for _, orphan := range orphans {
+		records = append(records, []string{orphan.Word})
+	}
+
+	return writeCsvReport(out, records)
+}
+
+func writeJsonReport(out *bufio.Writer, value any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(value); err != nil {
+		return errors.Wrap(err, "could not write report")
+	}
+
+	return nil
+}
+
+func writeCsvReport(out *bufio.Writer, records [][]string) error {
+	if err := csv.NewWriter(out).WriteAll(records); err != nil {
+		return errors.Wrap(err, "could not write report")
+	}
+
+	return nil
+}
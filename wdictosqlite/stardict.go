@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Writes a StarDict dictionary. Given -outfile NAME, it creates NAME.ifo,
+// NAME.idx, NAME.dict.dz and, if any entry has alternative forms, NAME.syn.
+//
+// Articles are written to the dictionary file as they come in. The index
+// only needs the position of each article, so that is all we keep in
+// memory until Close sorts and writes it.
+type starDictWriter struct {
+	basePath    string
+	description string
+	bookName    string
+	createdOn   string
+	website     string
+
+	dict   *os.File
+	out    *bufio.Writer
+	offset int64
+
+	articles []starDictArticle
+	synonyms []starDictSynonym
+}
+
+// Location of a single article in the dictionary file.
+type starDictArticle struct {
+	word   string
+	offset uint32
+	size   uint32
+}
+
+// An alternative spelling that points to an article.
+type starDictSynonym struct {
+	word    string
+	article int
+}
+
+func NewStarDictWriter(args *Arguments, siteInfo wikidictools.SiteInfo) (EntryWriter, error) {
+	dict, err := os.Create(args.OutFile + ".dict")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create dictionary file")
+	}
+
+	description, err := ReadCopying(args)
+	if err != nil {
+		dict.Close()
+		return nil, err
+	}
+
+	created := &starDictWriter{
+		basePath:    args.OutFile,
+		description: description,
+		bookName:    DictionaryTitle(siteInfo),
+		createdOn:   args.CreatedOn,
+		website:     siteInfo.Base,
+		dict:        dict,
+		out:         bufio.NewWriter(dict),
+	}
+
+	return created, nil
+}
+
+func (sw *starDictWriter) WriteEntry(entry *wikidictools.DictionaryEntry) error {
+	if entry.IsEmpty() {
+		return nil
+	}
+
+	article := FormatPlainTextArticle(entry)
+
+	if sw.offset+int64(len(article)) > math.MaxUint32 {
+		return errors.New("dictionary file exceeds 4 GiB")
+	}
+
+	if _, err := sw.out.WriteString(article); err != nil {
+		return errors.Wrap(err, "could not write article")
+	}
+
+	sw.articles = append(sw.articles, starDictArticle{
+		word:   entry.Word,
+		offset: uint32(sw.offset),
+		size:   uint32(len(article)),
+	})
+
+	sw.offset += int64(len(article))
+
+	for _, form := range entry.AlternativeForms {
+		if form != entry.Word {
+			sw.synonyms = append(sw.synonyms, starDictSynonym{word: form, article: len(sw.articles) - 1})
+		}
+	}
+
+	return nil
+}
+
+func (sw *starDictWriter) Close() error {
+	if err := sw.out.Flush(); err != nil {
+		sw.dict.Close()
+		return errors.Wrap(err, "could not flush dictionary file")
+	}
+
+	if err := sw.dict.Close(); err != nil {
+		return errors.Wrap(err, "could not close dictionary file")
+	}
+
+	// StarDict readers use binary search on the index, so both index and
+	// synonyms must be sorted. Synonyms refer to articles by their position
+	// in the sorted index.
+
+	order := make([]int, len(sw.articles))
+
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return starDictLess(sw.articles[order[i]].word, sw.articles[order[j]].word)
+	})
+
+	positions := make([]int, len(sw.articles))
+
+	for position, article := range order {
+		positions[article] = position
+	}
+
+	sort.SliceStable(sw.synonyms, func(i, j int) bool {
+		return starDictLess(sw.synonyms[i].word, sw.synonyms[j].word)
+	})
+
+	idxSize, err := sw.writeIndex(order)
+	if err != nil {
+		return err
+	}
+
+	if err := sw.writeSynonyms(positions); err != nil {
+		return err
+	}
+
+	if err := sw.writeInfo(idxSize); err != nil {
+		return err
+	}
+
+	// Readers expect the dictionary compressed with dictzip.
+
+	dictPath := sw.basePath + ".dict"
+
+	if err := CompressToDictzip(dictPath, dictPath+".dz"); err != nil {
+		return errors.Wrap(err, "could not compress dictionary file")
+	}
+
+	return os.Remove(dictPath)
+}
+
+// Write the .idx file with articles in the given order. Returns the size
+// of the written file.
+func (sw *starDictWriter) writeIndex(order []int) (int64, error) {
+	var size int64
+
+	err := writeFileWith(sw.basePath+".idx", func(out *bufio.Writer) error {
+		for _, i := range order {
+			article := &sw.articles[i]
+
+			out.WriteString(article.word)
+			out.WriteByte(0)
+			binary.Write(out, binary.BigEndian, article.offset)
+			binary.Write(out, binary.BigEndian, article.size)
+
+			size += int64(len(article.word)) + 9
+		}
+
+		return nil
+	})
+
+	return size, err
+}
+
+// Write the .syn file. Positions maps each article to its position in the
+// sorted index.
+func (sw *starDictWriter) writeSynonyms(positions []int) error {
+	if len(sw.synonyms) == 0 {
+		return nil
+	}
+
+	return writeFileWith(sw.basePath+".syn", func(out *bufio.Writer) error {
+		for _, synonym := range sw.synonyms {
+			out.WriteString(synonym.word)
+			out.WriteByte(0)
+			binary.Write(out, binary.BigEndian, uint32(positions[synonym.article]))
+		}
+
+		return nil
+	})
+}
+
+// Write the .ifo file that describes the dictionary.
+func (sw *starDictWriter) writeInfo(idxSize int64) error {
+	return writeFileWith(sw.basePath+".ifo", func(out *bufio.Writer) error {
+		// Values must fit on a single line.
+
+		clean := func(s string) string {
+			s = strings.TrimSpace(s)
+			s = strings.ReplaceAll(s, "\r", "")
+			return strings.ReplaceAll(s, "\n", "<br>")
+		}
+
+		fmt.Fprintf(out, "StarDict's dict ifo file\n")
+		fmt.Fprintf(out, "version=3.0.0\n")
+		fmt.Fprintf(out, "bookname=%v\n", clean(sw.bookName))
+		fmt.Fprintf(out, "wordcount=%v\n", len(sw.articles))
+
+		if len(sw.synonyms) > 0 {
+			fmt.Fprintf(out, "synwordcount=%v\n", len(sw.synonyms))
+		}
+
+		fmt.Fprintf(out, "idxfilesize=%v\n", idxSize)
+		fmt.Fprintf(out, "sametypesequence=m\n")
+
+		if sw.website != "" {
+			fmt.Fprintf(out, "website=%v\n", clean(sw.website))
+		}
+
+		if sw.description != "" {
+			fmt.Fprintf(out, "description=%v\n", clean(sw.description))
+		}
+
+		fmt.Fprintf(out, "date=%v\n", clean(sw.createdOn))
+
+		return nil
+	})
+}
+
+// Return whether a sorts before b in a StarDict index. StarDict compares
+// case-insensitively for ASCII letters first and falls back to plain byte
+// order for words that only differ in case.
+func starDictLess(a, b string) bool {
+	if c := asciiCaseCompare(a, b); c != 0 {
+		return c < 0
+	}
+
+	return a < b
+}
+
+// Compare a and b byte by byte with ASCII letters folded to lower case,
+// just like g_ascii_strcasecmp.
+func asciiCaseCompare(a, b string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ca, cb := asciiToLower(a[i]), asciiToLower(b[i])
+
+		if ca != cb {
+			return int(ca) - int(cb)
+		}
+	}
+
+	return len(a) - len(b)
+}
+
+func asciiToLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+
+	return c
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kissen/wikidictools/wikidictdb"
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Print words of a database that are spelled like the given word, closest
+// first. Each line has the word, its edit distance and its number of
+// references, separated by tabs.
+func RunSuggest(argv []string) error {
+	var (
+		sqlFile     string
+		word        string
+		outFile     string
+		maxDistance int
+		limit       int
+	)
+
+	flags := flag.NewFlagSet(os.Args[0]+" suggest", flag.ExitOnError)
+	flags.StringVar(&sqlFile, "db", "", "database file to read, required")
+	flags.StringVar(&word, "word", "", "word to look up, required")
+	flags.StringVar(&outFile, "outfile", "--", "file to write to or -- for stdout")
+	flags.IntVar(&maxDistance, "maxdistance", wikidictools.FUZZY_MAX_DISTANCE, "maximum edit distance")
+	flags.IntVar(&limit, "limit", 10, "maximum number of words to print")
+	flags.Parse(argv)
+
+	if sqlFile == "" || word == "" || limit < 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	db, err := wikidictdb.Open(sqlFile)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	suggestions, err := db.Suggest(word, maxDistance, limit)
+	if err != nil {
+		return err
+	}
+
+	file, err := OpenOutputFile(outFile)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(file)
+
+	for _, suggestion := range suggestions {
+		fmt.Fprintf(out, "%v\t%v\t%v\n", suggestion.Word.Word, suggestion.Distance, suggestion.NReferences)
+	}
+
+	if err := out.Flush(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "could not flush output")
+	}
+
+	return file.Close()
+}
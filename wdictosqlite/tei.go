@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Namespace of all TEI elements.
+const TEI_NAMESPACE = "http://www.tei-c.org/ns/1.0"
+
+// Universal Dependencies tags TEI Lex-0 recommends for normalizing parts of
+// speech. Phrases have no such tag.
+var teiPartOfSpeechTags = map[string]string{
+	"noun":      "NOUN",
+	"verb":      "VERB",
+	"adjective": "ADJ",
+	"adverb":    "ADV",
+}
+
+// Writes a single TEI Lex-0 document. Every part of speech of a word becomes
+// an <entry> of its own with one <sense> per definition. Entries are written
+// as they come in, nothing is kept in memory.
+type teiWriter struct {
+	file io.WriteCloser
+	out  *bufio.Writer
+}
+
+func NewTeiWriter(args *Arguments, siteInfo wikidictools.SiteInfo) (EntryWriter, error) {
+	copying, err := ReadCopying(args)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := OpenOutputFile(args.OutFile)
+	if err != nil {
+		return nil, err
+	}
+
+	created := &teiWriter{
+		file: file,
+		out:  bufio.NewWriter(file),
+	}
+
+	out := created.out
+
+	fmt.Fprintf(out, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(out, "<TEI xmlns=\"%v\">\n", TEI_NAMESPACE)
+	fmt.Fprintf(out, "  <teiHeader>\n")
+	fmt.Fprintf(out, "    <fileDesc>\n")
+	fmt.Fprintf(out, "      <titleStmt>\n")
+	fmt.Fprintf(out, "        <title>%v</title>\n", xmlEscape(DictionaryTitle(siteInfo)))
+	fmt.Fprintf(out, "      </titleStmt>\n")
+	fmt.Fprintf(out, "      <publicationStmt>\n")
+	fmt.Fprintf(out, "        <publisher>wdictosqlite %v</publisher>\n", xmlEscape(ToolVersion()))
+	fmt.Fprintf(out, "        <date>%v</date>\n", xmlEscape(args.CreatedOn))
+
+	if copying != "" {
+		fmt.Fprintf(out, "        <availability>\n")
+		fmt.Fprintf(out, "          <p>%v</p>\n", xmlEscape(strings.TrimSpace(copying)))
+		fmt.Fprintf(out, "        </availability>\n")
+	}
+
+	fmt.Fprintf(out, "      </publicationStmt>\n")
+	fmt.Fprintf(out, "      <sourceDesc>\n")
+	fmt.Fprintf(out, "        <p>Created from the %v dump at %v.</p>\n", xmlEscape(siteInfo.DbName), xmlEscape(siteInfo.Base))
+	fmt.Fprintf(out, "      </sourceDesc>\n")
+	fmt.Fprintf(out, "    </fileDesc>\n")
+	fmt.Fprintf(out, "  </teiHeader>\n")
+	fmt.Fprintf(out, "  <text>\n")
+	fmt.Fprintf(out, "    <body>\n")
+
+	return created, nil
+}
+
+func (tw *teiWriter) WriteEntry(entry *wikidictools.DictionaryEntry) error {
+	if entry.IsEmpty() {
+		return nil
+	}
+
+	// Reconstructed words are written the way etymologists write them,
+	// with an asterisk. Their language is not one of ours.
+
+	orth, language := entry.Word, LANGUAGE_CODE
+
+	if entry.Reconstruction != nil {
+		orth, language = "*"+entry.Reconstruction.Form, "und"
+	}
+
+	out := tw.out
+
+	entry.ForEachPartOfSpeech(func(partOfSpeech string, definitions []string) bool {
+		id := xmlId(entry.Word) + "." + partOfSpeech
+
+		fmt.Fprintf(out, "      <entry xml:id=\"%v\" xml:lang=\"%v\">\n", id, language)
+		fmt.Fprintf(out, "        <form type=\"lemma\">\n")
+		fmt.Fprintf(out, "          <orth>%v</orth>\n", xmlEscape(orth))
+
+		for _, pronunciation := range entry.Pronunciations {
+			fmt.Fprintf(out, "          <pron xml:lang=\"%v-fonipa\">%v</pron>\n", language, xmlEscape(pronunciation))
+		}
+
+		fmt.Fprintf(out, "        </form>\n")
+
+		for _, form := range entry.AlternativeForms {
+			fmt.Fprintf(out, "        <form type=\"variant\">\n")
+			fmt.Fprintf(out, "          <orth>%v</orth>\n", xmlEscape(form))
+			fmt.Fprintf(out, "        </form>\n")
+		}
+
+		fmt.Fprintf(out, "        <gramGrp>\n")
+
+		if tag, ok := teiPartOfSpeechTags[partOfSpeech]; ok {
+			fmt.Fprintf(out, "          <pos norm=\"%v\">%v</pos>\n", tag, partOfSpeech)
+		} else {
+			fmt.Fprintf(out, "          <pos>%v</pos>\n", partOfSpeech)
+		}
+
+		fmt.Fprintf(out, "        </gramGrp>\n")
+
+		for _, etymology := range entry.Etymologies {
+			fmt.Fprintf(out, "        <etym>%v</etym>\n", xmlEscape(etymology))
+		}
+
+		for i, definition := range definitions {
+			fmt.Fprintf(out, "        <sense xml:id=\"%v.%v\" n=\"%v\">\n", id, i+1, i+1)
+			fmt.Fprintf(out, "          <def>%v</def>\n", xmlEscape(wikidictools.StripLinksFrom(definition)))
+			fmt.Fprintf(out, "        </sense>\n")
+		}
+
+		fmt.Fprintf(out, "      </entry>\n")
+
+		return true
+	})
+
+	return nil
+}
+
+func (tw *teiWriter) Close() error {
+	fmt.Fprintf(tw.out, "    </body>\n")
+	fmt.Fprintf(tw.out, "  </text>\n")
+	fmt.Fprintf(tw.out, "</TEI>\n")
+
+	if err := tw.out.Flush(); err != nil {
+		tw.file.Close()
+		return errors.Wrap(err, "could not flush output")
+	}
+
+	return tw.file.Close()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kissen/wikidictools/wikidictools"
+)
+
+// The parts of a TEI document we check. Elements are in TEI_NAMESPACE
+// unless given otherwise.
+type teiTestDocument struct {
+	XMLName xml.Name `xml:"http://www.tei-c.org/ns/1.0 TEI"`
+
+	Header *struct {
+		Title string `xml:"fileDesc>titleStmt>title"`
+	} `xml:"teiHeader"`
+
+	Entries []teiTestEntry `xml:"text>body>entry"`
+}
+
+type teiTestEntry struct {
+	Id    string   `xml:"http://www.w3.org/XML/1998/namespace id,attr"`
+	Lang  string   `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Orths []string `xml:"form>orth"`
+	Pos   string   `xml:"gramGrp>pos"`
+	Defs  []string `xml:"sense>def"`
+}
+
+// Write a sample entry with the TEI writer and return the location of the
+// output.
+func writeTeiSample(t *testing.T) string {
+	outFile := filepath.Join(t.TempDir(), "out.xml")
+
+	args := &Arguments{
+		OutFile:   outFile,
+		CreatedOn: "2024-03-01T00:00:00Z",
+	}
+
+	siteInfo := wikidictools.SiteInfo{
+		SiteName: "Wiktionary",
+		DbName:   "enwiktionary",
+		Base:     "https://en.wiktionary.org/wiki/Wiktionary:Main_Page",
+	}
+
+	writer, err := NewTeiWriter(args, siteInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &wikidictools.DictionaryEntry{
+		Word:             "cat",
+		AlternativeForms: []string{"catte"},
+		Pronunciations:   []string{"/kæt/"},
+		Etymologies:      []string{"From Middle English catte."},
+		Noun:             []string{"A small domesticated [[mammal]] & pet.", "(rare) A [[whip]]."},
+		Verb:             []string{"To <hoist> an anchor."},
+	}
+
+	if err := writer.WriteEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return outFile
+}
+
+func TestTeiWriter(t *testing.T) {
+	contents, err := ioutil.ReadFile(writeTeiSample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document teiTestDocument
+
+	if err := xml.Unmarshal(contents, &document); err != nil {
+		t.Fatalf("output is not well-formed: %v\n%s", err, contents)
+	}
+
+	if document.Header == nil {
+		t.Fatal("missing teiHeader")
+	}
+
+	if document.Header.Title != "Wiktionary (English)" {
+		t.Errorf("got title %q", document.Header.Title)
+	}
+
+	expected := []teiTestEntry{
+		{
+			Id:    "cat.noun",
+			Lang:  "en",
+			Orths: []string{"cat", "catte"},
+			Pos:   "noun",
+			Defs:  []string{"A small domesticated mammal & pet.", "(rare) A whip."},
+		},
+		{
+			Id:    "cat.verb",
+			Lang:  "en",
+			Orths: []string{"cat", "catte"},
+			Pos:   "verb",
+			Defs:  []string{"To <hoist> an anchor."},
+		},
+	}
+
+	if !reflect.DeepEqual(document.Entries, expected) {
+		t.Errorf("got entries %+v, expected %+v", document.Entries, expected)
+	}
+}
+
+// Validate the output against the part of TEI Lex-0 in testdata or, if
+// TEI_LEX0_RNG is set, against the full schema at that location.
+func TestTeiWriterLex0(t *testing.T) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint not found, not validating against TEI Lex-0")
+	}
+
+	schema := os.Getenv("TEI_LEX0_RNG")
+
+	if schema == "" {
+		schema = filepath.Join("testdata", "tei-lex0-subset.rng")
+	}
+
+	outFile := writeTeiSample(t)
+
+	output, err := exec.Command(xmllint, "--noout", "--relaxng", schema, outFile).CombinedOutput()
+	if err != nil {
+		t.Errorf("output does not validate against %v: %v\n%s", schema, err, output)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "runtime/debug"
+
+// Return the module version this binary was built from. Binaries built
+// from a local checkout report "(devel)".
+func ToolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	return info.Main.Version
+}
+
+// Return the VCS revision this binary was built from, suffixed with
+// "-dirty" if the working tree had local modifications. Returns "unknown"
+// if the revision was not stamped into the binary, e.g. when installed
+// with "go install".
+func ToolCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	var revision, modified string
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+
+	if revision == "" {
+		return "unknown"
+	}
+
+	if modified == "true" {
+		return revision + "-dirty"
+	}
+
+	return revision
+}
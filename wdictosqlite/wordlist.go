@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kissen/wikidictools/wikidictdb"
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Labels that mark a word as offensive. Only labels that all definitions
+// of a word share count, so a word with one definition labeled "vulgar"
+// and another labeled "offensive" is kept.
+var offensiveLabels = []string{"offensive", "vulgar", "derogatory", "pejorative", "slur", "ethnic slur"}
+
+// Labels that mark a word as rare. As with offensiveLabels, all
+// definitions of a word need to share the label.
+var rareLabels = []string{"rare", "obsolete", "archaic", "very rare"}
+
+// Which words end up in a word list.
+type wordListFilter struct {
+	// Leave out proper nouns.
+	noProperNouns bool
+
+	// Leave out words whose definitions share an offensive label.
+	noOffensive bool
+
+	// Leave out words whose definitions share a rare label.
+	noRare bool
+
+	// Leave out words with fewer references.
+	minReferences int64
+}
+
+// Export all words of a database together with their inflected forms as
+// a sorted word list for spell checkers.
+func RunWordList(argv []string) error {
+	var (
+		sqlFile string
+		outFile string
+		format  string
+		filter  wordListFilter
+	)
+
+	flags := flag.NewFlagSet(os.Args[0]+" wordlist", flag.ExitOnError)
+	flags.StringVar(&sqlFile, "db", "", "database file to read, required")
+	flags.StringVar(&outFile, "outfile", "", "file to write to, required")
+	flags.StringVar(&format, "format", "hunspell", "output format, one of hunspell, plain")
+	flags.BoolVar(&filter.noProperNouns, "noproper", false, "leave out proper nouns")
+	flags.BoolVar(&filter.noOffensive, "nooffensive", false, "leave out words whose senses all share an offensive label")
+	flags.BoolVar(&filter.noRare, "norare", false, "leave out words whose senses all share a rare, archaic or obsolete label")
+	flags.Int64Var(&filter.minReferences, "minreferences", 0, "leave out words with fewer links to them")
+	flags.Parse(argv)
+
+	if sqlFile == "" || outFile == "" || (format != "hunspell" && format != "plain") {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	db, err := wikidictdb.Open(sqlFile)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	words, err := selectWordList(db, &filter)
+	if err != nil {
+		return err
+	}
+
+	if format == "plain" {
+		err = writePlainWordList(outFile, words)
+	} else {
+		err = writeHunspellDictionary(outFile, words)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%v: done exporting %v words\n", os.Args[0], len(words))
+	return nil
+}
+
+// Return the words of db that pass filter together with their inflected
+// forms, sorted and without duplicates. Reconstructed words and words
+// with spaces are left out; spell checkers look at single words only.
+func selectWordList(db *wikidictdb.Database, filter *wordListFilter) ([]string, error) {
+	var candidates []string
+
+	err := db.ForEachWord(func(word wikidictdb.Word) bool {
+		if word.NReferences >= filter.minReferences {
+			candidates = append(candidates, word.Word)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	unique := make(map[string]bool)
+
+	for _, word := range candidates {
+		entry, err := db.Lookup(word)
+		if err != nil {
+			return nil, err
+		}
+
+		if !filter.accepts(entry) {
+			continue
+		}
+
+		for _, form := range append([]string{entry.Word}, entry.Inflections...) {
+			if !strings.ContainsAny(form, " \t") {
+				unique[form] = true
+			}
+		}
+	}
+
+	words := make([]string, 0, len(unique))
+
+	for word := range unique {
+		words = append(words, word)
+	}
+
+	sort.Strings(words)
+	return words, nil
+}
+
+// Return whether entry belongs in the word list.
+func (f *wordListFilter) accepts(entry *wikidictools.DictionaryEntry) bool {
+	// Only the main namespace has regular dictionary entries.
+
+	if entry.IsEmpty() || entry.Namespace != 0 || entry.Reconstruction != nil {
+		return false
+	}
+
+	if f.noProperNouns && entry.ProperNoun {
+		return false
+	}
+
+	if f.noOffensive && len(wikidictools.Intersect(entry.Labels, offensiveLabels)) > 0 {
+		return false
+	}
+
+	if f.noRare && len(wikidictools.Intersect(entry.Labels, rareLabels)) > 0 {
+		return false
+	}
+
+	return true
+}
+
+// Write words to outFile, one per line.
+func writePlainWordList(outFile string, words []string) error {
+	file, err := OpenOutputFile(outFile)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(file)
+
+	for _, word := range words {
+		fmt.Fprintf(out, "%v\n", word)
+	}
+
+	if err := out.Flush(); err != nil {
+		file.Close()
+		return errors.Wrap(err, "could not flush output")
+	}
+
+	return file.Close()
+}
+
+// Write words as Hunspell dictionary. Given outFile NAME, this creates
+// NAME.dic and NAME.aff. Inflected forms are listed as words of their own,
+// so the affix file has no rules. It only tells Hunspell which characters
+// to try when making suggestions.
+func writeHunspellDictionary(outFile string, words []string) error {
+	err := writeFileWith(outFile+".dic", func(out *bufio.Writer) error {
+		fmt.Fprintf(out, "%v\n", len(words))
+
+		// Everything after a slash are flags. Slashes in words need to be
+		// escaped.
+
+		for _, word := range words {
+			fmt.Fprintf(out, "%v\n", strings.ReplaceAll(word, "/", `\/`))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Letters are tried in order of frequency. Characters other than
+	// letters that are part of words, like apostrophes or hyphens, need
+	// to be listed as well, or Hunspell splits words at them.
+
+	letters := make(map[rune]int)
+	wordChars := make(map[rune]bool)
+
+	for _, word := range words {
+		for _, r := range word {
+			if unicode.IsLetter(r) {
+				letters[r] += 1
+			} else {
+				wordChars[r] = true
+			}
+		}
+	}
+
+	try := make([]rune, 0, len(letters))
+
+	for r := range letters {
+		try = append(try, r)
+	}
+
+	sort.Slice(try, func(i, j int) bool {
+		if letters[try[i]] != letters[try[j]] {
+			return letters[try[i]] > letters[try[j]]
+		}
+
+		return try[i] < try[j]
+	})
+
+	var chars []rune
+
+	for r := range wordChars {
+		chars = append(chars, r)
+	}
+
+	sort.Slice(chars, func(i, j int) bool {
+		return chars[i] < chars[j]
+	})
+
+	return writeFileWith(outFile+".aff", func(out *bufio.Writer) error {
+		fmt.Fprintf(out, "SET UTF-8\n")
+		fmt.Fprintf(out, "TRY %v\n", string(try))
+
+		if len(chars) > 0 {
+			fmt.Fprintf(out, "WORDCHARS %v\n", string(chars))
+		}
+
+		return nil
+	})
+}
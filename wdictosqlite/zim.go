@@ -0,0 +1,581 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Identifies ZIM files.
+const ZIM_MAGIC_NUMBER = 72173914
+
+// Size of the fixed header at the start of each ZIM file.
+const ZIM_HEADER_LENGTH = 80
+
+// Clusters are written once their blobs add up to this many bytes. Readers
+// load whole clusters, so they should not get too large.
+const ZIM_CLUSTER_SIZE = 1024 * 1024
+
+// Marks the absence of a main or layout page and redirect entries.
+const ZIM_NONE = 0xffffffff
+
+// URL of the page that shows the text passed with -copying.
+const ZIM_ABOUT_URL = "About_this_dictionary"
+
+// Style sheet of all pages.
+const ZIM_CSS = `body { font-family: sans-serif; max-width: 40em; margin: auto; }
+.pron { color: gray; }
+.etym, .forms { font-size: 90%; }
+`
+
+// MIME types of all blobs. The index into this list is what directory
+// entries store.
+var zimMimeTypes = []string{"text/html", "text/plain", "text/css"}
+
+const (
+	zimHtml = iota
+	zimPlainText
+	zimCss
+)
+
+// ISO 639-3 code of LANGUAGE_CODE as required by the Language metadata.
+const ZIM_LANGUAGE_CODE = "eng"
+
+// Writes a ZIM archive for Kiwix. Each entry becomes an HTML page in
+// namespace A with links to the words its definitions link to. Alternative
+// and inflected forms redirect to the page of their word. The archive uses
+// the namespaces of major version 5 and uncompressed clusters. There is no
+// full-text index; readers search the title index.
+//
+// ZIM files start with the directory, which has to be sorted, but we only
+// know all entries at the very end. So clusters go to a temporary file as
+// they fill up and only the directory is kept in memory. Close then writes
+// the directory and appends the clusters.
+type zimWriter struct {
+	outFile  string
+	title    string
+	copying  string
+	args     *Arguments
+	siteInfo wikidictools.SiteInfo
+
+	clusters     *os.File
+	clustersOut  *bufio.Writer
+	clustersSize uint64
+
+	// Offsets of written clusters relative to the start of the temporary
+	// file.
+	clusterOffsets []uint64
+
+	// Blobs of the cluster we are filling.
+	blobs     [][]byte
+	blobsSize int
+
+	entries []zimEntry
+}
+
+// A single directory entry, either content or a redirect.
+type zimEntry struct {
+	namespace byte
+	url       string
+	title     string
+	mimeType  uint16
+
+	// Location of the content.
+	cluster uint32
+	blob    uint32
+
+	// For redirects, the URL in namespace A that they point to.
+	redirect string
+}
+
+func NewZimWriter(args *Arguments, siteInfo wikidictools.SiteInfo) (EntryWriter, error) {
+	copying, err := ReadCopying(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clusters can get large, so we keep them next to the output unless it
+	// goes to stdout.
+
+	var clusters *os.File
+
+	if args.OutFile == "--" {
+		clusters, err = os.CreateTemp("", "wdictosqlite-*.clusters")
+	} else {
+		clusters, err = os.Create(args.OutFile + ".clusters")
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create temporary file")
+	}
+
+	created := &zimWriter{
+		outFile:     args.OutFile,
+		title:       DictionaryTitle(siteInfo),
+		copying:     strings.TrimSpace(copying),
+		args:        args,
+		siteInfo:    siteInfo,
+		clusters:    clusters,
+		clustersOut: bufio.NewWriter(clusters),
+	}
+
+	return created, nil
+}
+
+func (zw *zimWriter) WriteEntry(entry *wikidictools.DictionaryEntry) error {
+	if entry.IsEmpty() {
+		return nil
+	}
+
+	if err := zw.addContent('A', entry.Word, "", zimHtml, []byte(zw.formatPage(entry))); err != nil {
+		return err
+	}
+
+	forms := append(append([]string{}, entry.AlternativeForms...), entry.Inflections...)
+
+	for _, form := range forms {
+		if form != entry.Word {
+			zw.entries = append(zw.entries, zimEntry{namespace: 'A', url: form, redirect: entry.Word})
+		}
+	}
+
+	return nil
+}
+
+func (zw *zimWriter) Close() error {
+	if err := zw.finish(); err != nil {
+		zw.clusters.Close()
+		os.Remove(zw.clusters.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (zw *zimWriter) finish() error {
+	if err := zw.addSpecialPages(); err != nil {
+		return err
+	}
+
+	if err := zw.flushCluster(); err != nil {
+		return err
+	}
+
+	if err := zw.clustersOut.Flush(); err != nil {
+		return errors.Wrap(err, "could not write clusters")
+	}
+
+	entries := zw.sortedEntries()
+
+	dst, err := OpenOutputFile(zw.outFile)
+	if err != nil {
+		return err
+	}
+
+	// Everything but the checksum goes into the checksum.
+
+	checksum := md5.New()
+	out := bufio.NewWriter(io.MultiWriter(dst, checksum))
+
+	if err := zw.writeArchive(out, entries); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := out.Flush(); err != nil {
+		dst.Close()
+		return errors.Wrap(err, "could not write archive")
+	}
+
+	if _, err := dst.Write(checksum.Sum(nil)); err != nil {
+		dst.Close()
+		return errors.Wrap(err, "could not write checksum")
+	}
+
+	if err := dst.Close(); err != nil {
+		return errors.Wrap(err, "could not close archive")
+	}
+
+	zw.clusters.Close()
+	return os.Remove(zw.clusters.Name())
+}
+
+// Add the about page, the style sheet and the metadata of the archive.
+func (zw *zimWriter) addSpecialPages() error {
+	var about strings.Builder
+
+	fmt.Fprintf(&about, "<h1>%v</h1>\n", xmlEscape(zw.title))
+	fmt.Fprintf(&about, "<p>Created on %v from the %v dump.</p>\n", xmlEscape(zw.args.CreatedOn), xmlEscape(zw.siteInfo.DbName))
+
+	for _, paragraph := range strings.Split(zw.copying, "\n\n") {
+		if paragraph != "" {
+			fmt.Fprintf(&about, "<p>%v</p>\n", xmlEscape(paragraph))
+		}
+	}
+
+	page := zw.formatHtml(ZIM_ABOUT_URL, "About", about.String())
+
+	if err := zw.addContent('A', ZIM_ABOUT_URL, "About", zimHtml, []byte(page)); err != nil {
+		return err
+	}
+
+	if err := zw.addContent('-', "style.css", "", zimCss, []byte(ZIM_CSS)); err != nil {
+		return err
+	}
+
+	date := zw.args.CreatedOn
+
+	if len(date) > 10 {
+		date = date[:10]
+	}
+
+	metadata := []struct {
+		name  string
+		value string
+	}{
+		{"Title", zw.title},
+		{"Description", fmt.Sprintf("Definitions from the %v dump", zw.siteInfo.DbName)},
+		{"Language", ZIM_LANGUAGE_CODE},
+		{"Creator", "Wiktionary contributors"},
+		{"Publisher", "wdictosqlite"},
+		{"Date", date},
+		{"Name", zw.siteInfo.DbName + "_" + LANGUAGE_CODE},
+		{"Source", zw.siteInfo.Base},
+	}
+
+	for _, m := range metadata {
+		if err := zw.addContent('M', m.name, "", zimPlainText, []byte(m.value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Add a blob to the current cluster and a directory entry pointing to it.
+func (zw *zimWriter) addContent(namespace byte, path, title string, mimeType uint16, content []byte) error {
+	if zw.blobsSize > 0 && zw.blobsSize+len(content) > ZIM_CLUSTER_SIZE {
+		if err := zw.flushCluster(); err != nil {
+			return err
+		}
+	}
+
+	zw.entries = append(zw.entries, zimEntry{
+		namespace: namespace,
+		url:       path,
+		title:     title,
+		mimeType:  mimeType,
+		cluster:   uint32(len(zw.clusterOffsets)),
+		blob:      uint32(len(zw.blobs)),
+	})
+
+	zw.blobs = append(zw.blobs, content)
+	zw.blobsSize += len(content)
+
+	return nil
+}
+
+// Write the current cluster to the temporary file.
+func (zw *zimWriter) flushCluster() error {
+	if len(zw.blobs) == 0 {
+		return nil
+	}
+
+	// Uncompressed clusters start with a byte that says so, followed by
+	// the offset of each blob and of the end of the last blob.
+
+	cluster := []byte{1}
+	offset := uint32(4 * (len(zw.blobs) + 1))
+
+	for _, blob := range zw.blobs {
+		cluster = appendUint32(cluster, offset)
+		offset += uint32(len(blob))
+	}
+
+	cluster = appendUint32(cluster, offset)
+
+	for _, blob := range zw.blobs {
+		cluster = append(cluster, blob...)
+	}
+
+	if _, err := zw.clustersOut.Write(cluster); err != nil {
+		return errors.Wrap(err, "could not write cluster")
+	}
+
+	zw.clusterOffsets = append(zw.clusterOffsets, zw.clustersSize)
+	zw.clustersSize += uint64(len(cluster))
+
+	zw.blobs = nil
+	zw.blobsSize = 0
+
+	return nil
+}
+
+// Return all directory entries sorted by namespace and URL, the order
+// ZIM requires. Redirects whose URL is taken by content are dropped,
+// content wins over redirects.
+func (zw *zimWriter) sortedEntries() []zimEntry {
+	sort.SliceStable(zw.entries, func(i, j int) bool {
+		a, b := &zw.entries[i], &zw.entries[j]
+
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+
+		if a.url != b.url {
+			return a.url < b.url
+		}
+
+		return a.redirect == "" && b.redirect != ""
+	})
+
+	entries := zw.entries[:0]
+
+	for i, entry := range zw.entries {
+		if i > 0 && entry.namespace == entries[len(entries)-1].namespace && entry.url == entries[len(entries)-1].url {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// Write everything up to the checksum.
+func (zw *zimWriter) writeArchive(out *bufio.Writer, entries []zimEntry) error {
+	// Redirects store the index of their target.
+
+	indices := make(map[string]uint32)
+
+	for i, entry := range entries {
+		if entry.namespace == 'A' && entry.redirect == "" {
+			indices[entry.url] = uint32(i)
+		}
+	}
+
+	var mimeList []byte
+
+	for _, mimeType := range zimMimeTypes {
+		mimeList = append(append(mimeList, mimeType...), 0)
+	}
+
+	mimeList = append(mimeList, 0)
+
+	directory := make([][]byte, len(entries))
+
+	for i, entry := range entries {
+		directory[i] = zw.formatDirectoryEntry(&entry, indices)
+	}
+
+	// Titles default to the URL.
+
+	titleOrder := make([]uint32, len(entries))
+
+	for i := range titleOrder {
+		titleOrder[i] = uint32(i)
+	}
+
+	sort.SliceStable(titleOrder, func(i, j int) bool {
+		a, b := &entries[titleOrder[i]], &entries[titleOrder[j]]
+
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+
+		return a.displayTitle() < b.displayTitle()
+	})
+
+	// Now we know the position of everything.
+
+	mimeListPos := uint64(ZIM_HEADER_LENGTH)
+	urlPtrPos := mimeListPos + uint64(len(mimeList))
+	titlePtrPos := urlPtrPos + 8*uint64(len(entries))
+	directoryPos := titlePtrPos + 4*uint64(len(entries))
+	clusterPtrPos := directoryPos
+
+	for _, dirent := range directory {
+		clusterPtrPos += uint64(len(dirent))
+	}
+
+	clustersPos := clusterPtrPos + 8*uint64(len(zw.clusterOffsets))
+	checksumPos := clustersPos + zw.clustersSize
+
+	mainPage, ok := indices[ZIM_ABOUT_URL]
+	if !ok {
+		mainPage = ZIM_NONE
+	}
+
+	// The UUID only needs to be unique, so we derive it from what tells
+	// apart our archives.
+
+	uuid := md5.Sum([]byte(zw.siteInfo.DbName + "\x00" + zw.args.CreatedOn + "\x00" + zw.title))
+
+	var header []byte
+
+	header = appendUint32(header, ZIM_MAGIC_NUMBER)
+	header = appendUint16(header, 5)
+	header = appendUint16(header, 0)
+	header = append(header, uuid[:]...)
+	header = appendUint32(header, uint32(len(entries)))
+	header = appendUint32(header, uint32(len(zw.clusterOffsets)))
+	header = appendUint64(header, urlPtrPos)
+	header = appendUint64(header, titlePtrPos)
+	header = appendUint64(header, clusterPtrPos)
+	header = appendUint64(header, mimeListPos)
+	header = appendUint32(header, mainPage)
+	header = appendUint32(header, ZIM_NONE)
+	header = appendUint64(header, checksumPos)
+
+	out.Write(header)
+	out.Write(mimeList)
+
+	var buffer [8]byte
+
+	position := directoryPos
+
+	for _, dirent := range directory {
+		binary.LittleEndian.PutUint64(buffer[:], position)
+		out.Write(buffer[:8])
+		position += uint64(len(dirent))
+	}
+
+	for _, index := range titleOrder {
+		binary.LittleEndian.PutUint32(buffer[:], index)
+		out.Write(buffer[:4])
+	}
+
+	for _, dirent := range directory {
+		out.Write(dirent)
+	}
+
+	for _, offset := range zw.clusterOffsets {
+		binary.LittleEndian.PutUint64(buffer[:], clustersPos+offset)
+		out.Write(buffer[:8])
+	}
+
+	if _, err := zw.clusters.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "could not read clusters")
+	}
+
+	if _, err := io.Copy(out, zw.clusters); err != nil {
+		return errors.Wrap(err, "could not copy clusters")
+	}
+
+	return nil
+}
+
+// Return the binary directory entry for entry. Redirects are resolved
+// with indices, which maps URLs in namespace A to their index.
+func (zw *zimWriter) formatDirectoryEntry(entry *zimEntry, indices map[string]uint32) []byte {
+	var dirent []byte
+
+	if entry.redirect != "" {
+		dirent = appendUint16(dirent, 0xffff)
+		dirent = append(dirent, 0, entry.namespace)
+		dirent = appendUint32(dirent, 0)
+		dirent = appendUint32(dirent, indices[entry.redirect])
+	} else {
+		dirent = appendUint16(dirent, entry.mimeType)
+		dirent = append(dirent, 0, entry.namespace)
+		dirent = appendUint32(dirent, 0)
+		dirent = appendUint32(dirent, entry.cluster)
+		dirent = appendUint32(dirent, entry.blob)
+	}
+
+	dirent = append(append(dirent, entry.url...), 0)
+	dirent = append(append(dirent, entry.title...), 0)
+
+	return dirent
+}
+
+// Return the HTML page of entry.
+func (zw *zimWriter) formatPage(entry *wikidictools.DictionaryEntry) string {
+	var body strings.Builder
+
+	fmt.Fprintf(&body, "<h1>%v</h1>\n", xmlEscape(entry.Word))
+
+	if len(entry.Pronunciations) > 0 {
+		fmt.Fprintf(&body, "<p class=\"pron\">%v</p>\n", xmlEscape(strings.Join(entry.Pronunciations, ", ")))
+	}
+
+	entry.ForEachPartOfSpeech(func(partOfSpeech string, definitions []string) bool {
+		fmt.Fprintf(&body, "<h2>%v</h2>\n", partOfSpeech)
+		fmt.Fprintf(&body, "<ol>\n")
+
+		for _, definition := range definitions {
+			fmt.Fprintf(&body, "<li>%v</li>\n", formatHtmlDefinition(definition, func(target, text string) string {
+				return fmt.Sprintf("<a href=\"%v\">%v</a>", zimLink(entry.Word, target), text)
+			}))
+		}
+
+		fmt.Fprintf(&body, "</ol>\n")
+		return true
+	})
+
+	for _, etymology := range entry.Etymologies {
+		fmt.Fprintf(&body, "<p class=\"etym\">%v</p>\n", xmlEscape(etymology))
+	}
+
+	if len(entry.AlternativeForms) > 0 {
+		fmt.Fprintf(&body, "<p class=\"forms\">Alternative forms: %v</p>\n", xmlEscape(strings.Join(entry.AlternativeForms, ", ")))
+	}
+
+	return zw.formatHtml(entry.Word, entry.Word, body.String())
+}
+
+// Return a complete HTML page at path with the given title and body.
+func (zw *zimWriter) formatHtml(path, title, body string) string {
+	var page strings.Builder
+
+	fmt.Fprintf(&page, "<!DOCTYPE html>\n")
+	fmt.Fprintf(&page, "<html lang=\"%v\">\n", LANGUAGE_CODE)
+	fmt.Fprintf(&page, "<head>\n")
+	fmt.Fprintf(&page, "<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&page, "<title>%v</title>\n", xmlEscape(title))
+	fmt.Fprintf(&page, "<link rel=\"stylesheet\" href=\"%v../-/style.css\">\n", zimRelativeRoot(path))
+	fmt.Fprintf(&page, "</head>\n")
+	fmt.Fprintf(&page, "<body>\n")
+	page.WriteString(body)
+	fmt.Fprintf(&page, "</body>\n")
+	fmt.Fprintf(&page, "</html>\n")
+
+	return page.String()
+}
+
+// Return the title readers show for the entry.
+func (e *zimEntry) displayTitle() string {
+	if e.title != "" {
+		return e.title
+	}
+
+	return e.url
+}
+
+// Return the relative link from the page at path to the page of target,
+// both in namespace A, escaped for use in an attribute. Like all links
+// from formatHtmlDefinition, target is XML-escaped already.
+func zimLink(path, target string) string {
+	return xmlEscape(zimRelativeRoot(path) + escapeZimPath(html.UnescapeString(target)))
+}
+
+// Return the relative path from the page at path to namespace A. URLs may
+// contain slashes, which readers treat like directories.
+func zimRelativeRoot(path string) string {
+	return "./" + strings.Repeat("../", strings.Count(path, "/"))
+}
+
+// Escape target for use as a relative path, keeping slashes.
+func escapeZimPath(target string) string {
+	return (&url.URL{Path: target}).EscapedPath()
+}
@@ -0,0 +1,436 @@
+// Package wikidictdb reads databases created by wdictosqlite.
+package wikidictdb
+
+import (
+	"database/sql"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Oldest schema version this package can read. Older files can be
+// upgraded with "wdictosqlite migrate". Some methods need later versions,
+// see queryVersions.
+const MINIMUM_SCHEMA_VERSION = 6
+
+// Returned by lookups if the word is not in the database.
+var ErrNotFound = errors.New("no such word")
+
+// A database created by wdictosqlite, opened for reading. All methods are
+// safe for concurrent use.
+type Database struct {
+	db         *sql.DB
+	statements map[string]*sql.Stmt
+
+	// Schema version of the file. Only queries that work with this
+	// version are prepared.
+	version int
+
+	// Whether the lookup keys of words have diacritics removed, as set
+	// with "wdictosqlite -stripdiacritics".
+	stripDiacritics bool
+}
+
+// A word together with the number of links to it.
+type Word struct {
+	Word        string `json:"word"`
+	NReferences int64  `json:"nreferences"`
+}
+
+// All queries, prepared once in Open. The keys are used with
+// Database.statement.
+var queries = map[string]string{
+	"meta": `SELECT key, value FROM meta;`,
+
+	"word": `SELECT id, word, revision, namespace FROM words WHERE word = $1;`,
+
+	"key": `SELECT coalesce(key, '') FROM words WHERE id = $1;`,
+
+	"properNoun": `SELECT proper_noun FROM words WHERE id = $1;`,
+
+	"exact": `SELECT word, nreferences FROM words WHERE word = $1;`,
+
+	"nreferences": `SELECT nreferences FROM words WHERE word = $1;`,
+
+	"score": `SELECT score FROM words WHERE word = $1;`,
+
+	"definitions": `
+		SELECT coalesce(pos, ''), definition FROM definitions
+		WHERE word_id = $1 ORDER BY rowid;`,
+
+	"pronunciations": `
+		SELECT pronunciation FROM pronunciations
+		WHERE word_id = $1 ORDER BY position;`,
+
+	"inflections": `
+		SELECT inflection FROM inflections
+		WHERE word_id = $1 ORDER BY position;`,
+
+	"labels": `SELECT label FROM labels WHERE word_id = $1 ORDER BY rowid;`,
+
+	"reconstruction": `SELECT language, form FROM reconstructions WHERE word_id = $1;`,
+
+	"descendants": `
+		SELECT depth, language, descendant, tree FROM descendants
+		WHERE word_id = $1 ORDER BY position;`,
+
+	"synonymSets": `
+		SELECT id, pos, sense, gloss, relation FROM synonym_sets
+		WHERE headword = $1 ORDER BY id;`,
+
+	"synonyms": `SELECT word FROM synonyms WHERE set_id = $1 ORDER BY rowid;`,
+
+	"all": `SELECT word, nreferences FROM words ORDER BY word LIMIT $1 OFFSET $2;`,
+
+	"prefix": `
+		SELECT word, nreferences FROM words
+		WHERE word >= $1 AND word < $2
+		ORDER BY word LIMIT $3 OFFSET $4;`,
+
+	"complete": `
+		SELECT word, nreferences FROM words
+		WHERE folded >= $1 AND folded < $2
+		ORDER BY nreferences DESC, word LIMIT $3;`,
+
+	"substring": `
+		SELECT word, nreferences FROM words
+		WHERE instr(word, $1) > 0
+		ORDER BY word LIMIT $2 OFFSET $3;`,
+
+	"search": `
+		SELECT words.word, words.nreferences FROM words_fts
+		JOIN words ON words.id = words_fts.docid
+		WHERE words_fts MATCH $1
+		ORDER BY words.nreferences DESC, words.word
+		LIMIT $2 OFFSET $3;`,
+
+	"mostReferenced": `
+		SELECT word, nreferences FROM words
+		ORDER BY nreferences DESC, word
+		LIMIT $1 OFFSET $2;`,
+
+	"normalized": `
+		SELECT word, nreferences FROM words
+		WHERE key = $1 ORDER BY nreferences DESC, word;`,
+
+	"highestScored": `
+		SELECT word, nreferences FROM words
+		ORDER BY score DESC, word
+		LIMIT $1 OFFSET $2;`,
+
+	"anagrams": `
+		SELECT word, nreferences FROM words
+		WHERE letters = $1 ORDER BY word;`,
+
+	// Picking a random ID is a lot faster than ORDER BY random(). IDs are
+	// mostly contiguous, so this is close enough to uniform.
+	"random": `
+		SELECT word FROM words
+		WHERE id >= (SELECT abs(random()) % max(id) + 1 FROM words)
+		ORDER BY id LIMIT 1;`,
+
+	"everyWord": `SELECT word, nreferences FROM words ORDER BY word;`,
+
+	"everyLink": `
+		SELECT words.word, links.target FROM links
+		JOIN words ON words.id = links.word_id
+		ORDER BY words.word, links.rowid;`,
+
+	"deleteVariant": `
+		SELECT words.word, words.nreferences, words.namespace, reconstructions.form
+		FROM delete_variants
+		JOIN words ON words.id = delete_variants.word_id
+		LEFT JOIN reconstructions ON reconstructions.word_id = words.id
+		WHERE delete_variants.variant = $1;`,
+
+	"soundex": `
+		SELECT word, nreferences FROM words
+		WHERE soundex = $1
+		ORDER BY nreferences DESC, word LIMIT $2 OFFSET $3;`,
+
+	"metaphone": `
+		SELECT word, nreferences FROM words
+		WHERE metaphone IN ($1, $2) OR metaphone_alt IN ($1, $2)
+		ORDER BY nreferences DESC, word LIMIT $3 OFFSET $4;`,
+
+	"ipa": `
+		SELECT word, nreferences FROM words
+		WHERE ipa_key = $1
+		ORDER BY nreferences DESC, word LIMIT $2 OFFSET $3;`,
+
+	"ipaOfWord": `
+		SELECT word, nreferences FROM words
+		WHERE ipa_key = (SELECT ipa_key FROM words WHERE word = $1)
+		ORDER BY nreferences DESC, word LIMIT $2 OFFSET $3;`,
+
+	"findByWord": `SELECT word, nreferences FROM words WHERE ` + findCondition + ` ORDER BY word;`,
+
+	"findByReferences": `SELECT word, nreferences FROM words WHERE ` + findCondition + ` ORDER BY nreferences DESC, word;`,
+
+	"findByScore": `SELECT word, nreferences FROM words WHERE ` + findCondition + ` ORDER BY score DESC, word;`,
+}
+
+// Schema versions that queries need because they use tables or columns
+// added after MINIMUM_SCHEMA_VERSION. Queries that are not listed work
+// with all files we can read.
+var queryVersions = map[string]int{
+	"pronunciations":   7,
+	"inflections":      8,
+	"labels":           8,
+	"properNoun":       8,
+	"anagrams":         9,
+	"soundex":          10,
+	"metaphone":        10,
+	"ipa":              10,
+	"ipaOfWord":        10,
+	"findByWord":       10,
+	"findByReferences": 10,
+	"deleteVariant":    11,
+	"complete":         12,
+	"key":              13,
+	"normalized":       13,
+	"score":            14,
+	"highestScored":    14,
+	"findByScore":      14,
+	"everyLink":        15,
+}
+
+// Condition of the find queries on the words table. Each criterion of
+// FindWords is a parameter that is NULL if the criterion is not set. Parts
+// of speech are a comma-separated list that starts and ends with a comma.
+// Definitions of files migrated from before schema version 6 have no part
+// of speech; like Lookup, we take them as nouns.
+const findCondition = `
+	($1 IS NULL OR word GLOB $1)
+	AND ($2 IS NULL OR length(word) >= $2)
+	AND ($3 IS NULL OR length(word) <= $3)
+	AND ($4 IS NULL OR NOT proper_noun)
+	AND ($5 IS NULL OR nreferences >= $5)
+	AND ($6 IS NULL OR letters = $6)
+	AND ($7 IS NULL OR EXISTS (
+		SELECT 1 FROM definitions
+		WHERE definitions.word_id = words.id AND instr($7, ',' || coalesce(pos, 'noun') || ',') > 0))
+	AND ($8 IS NULL OR soundex = $8)
+	AND ($9 IS NULL OR metaphone IN ($9, $10) OR metaphone_alt IN ($9, $10))
+	AND ($11 IS NULL OR ipa_key = $11)
+	AND ($12 IS NULL OR ipa_key = (SELECT ipa_key FROM words AS other WHERE other.word = $12))`
+
+// Open the database file at path for reading. Fails if the file does not
+// exist or has a schema older than MINIMUM_SCHEMA_VERSION.
+func Open(path string) (*Database, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, errors.Wrap(err, "could not open database file")
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+url.PathEscape(path)+"?mode=ro")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open database")
+	}
+
+	version, err := checkSchemaVersion(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	opened := &Database{
+		db:         db,
+		statements: make(map[string]*sql.Stmt),
+		version:    version,
+	}
+
+	for name, query := range queries {
+		if !opened.supports(name) {
+			continue
+		}
+
+		statement, err := db.Prepare(query)
+		if err != nil {
+			opened.Close()
+			return nil, errors.Wrapf(err, "could not prepare %v query", name)
+		}
+
+		opened.statements[name] = statement
+	}
+
+	meta, err := opened.Meta()
+	if err != nil {
+		opened.Close()
+		return nil, errors.Wrap(err, "could not read meta data")
+	}
+
+	opened.stripDiacritics = meta["StripDiacritics"] == "true"
+
+	return opened, nil
+}
+
+// Close the database and free all prepared statements.
+func (d *Database) Close() error {
+	for _, statement := range d.statements {
+		statement.Close()
+	}
+
+	return d.db.Close()
+}
+
+// Return all key/value pairs of the meta table, e.g. "CreatedOn" or
+// "Copying".
+func (d *Database) Meta() (map[string]string, error) {
+	meta := make(map[string]string)
+
+	err := d.queryRows("meta", func(rows *sql.Rows) error {
+		var key, value string
+
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+
+		meta[key] = value
+		return nil
+	})
+
+	return meta, err
+}
+
+// Return the schema version of db or an error if the schema is too old to
+// be read.
+func checkSchemaVersion(db *sql.DB) (int, error) {
+	var value string
+
+	err := db.QueryRow(`SELECT value FROM meta WHERE key = 'schema_version';`).Scan(&value)
+
+	// Files from before schema versioning have no schema_version key.
+
+	if err == sql.ErrNoRows {
+		value = "1"
+	} else if err != nil {
+		return 0, errors.Wrap(err, "could not read schema version")
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "bad schema version %q", value)
+	}
+
+	if version < MINIMUM_SCHEMA_VERSION {
+		return 0, errors.Errorf(
+			"database has schema version %v but at least version %v is required, run \"wdictosqlite migrate\" on it",
+			version, MINIMUM_SCHEMA_VERSION,
+		)
+	}
+
+	return version, nil
+}
+
+// Return whether the schema of the database is recent enough for query
+// name.
+func (d *Database) supports(name string) bool {
+	return d.version >= queryVersions[name]
+}
+
+// Return prepared statement name. Fails if the schema of the database is
+// too old for the query.
+func (d *Database) statement(name string) (*sql.Stmt, error) {
+	if !d.supports(name) {
+		return nil, errors.Errorf(
+			"database has schema version %v but version %v is required for %v query, run \"wdictosqlite migrate\" on it",
+			d.version, queryVersions[name], name,
+		)
+	}
+
+	return d.statements[name], nil
+}
+
+// Returned by scan functions of queryRows to stop iterating without an
+// error.
+var errStop = errors.New("stop iterating")
+
+// Run prepared statement name and call scan on each resulting row. If scan
+// returns an error, iteration stops and that error is returned as-is,
+// except for errStop, which is not an error.
+func (d *Database) queryRows(name string, scan func(rows *sql.Rows) error, args ...any) error {
+	statement, err := d.statement(name)
+	if err != nil {
+		return err
+	}
+
+	rows, err := statement.Query(args...)
+	if err != nil {
+		return errors.Wrapf(err, "could not run %v query", name)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err == errStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return errors.Wrapf(err, "could not read rows of %v query", name)
+	}
+
+	return nil
+}
+
+// Run prepared statement name that returns words and their number of
+// references.
+func (d *Database) queryWords(name string, args ...any) ([]Word, error) {
+	words := []Word{}
+
+	err := d.queryRows(name, func(rows *sql.Rows) error {
+		var word Word
+
+		if err := rows.Scan(&word.Word, &word.NReferences); err != nil {
+			return err
+		}
+
+		words = append(words, word)
+		return nil
+	}, args...)
+
+	return words, err
+}
+
+// Run prepared statement name that returns words and their number of
+// references and call f on each word. If f returns false, iteration stops.
+func (d *Database) forEachWord(name string, f func(word Word) bool, args ...any) error {
+	return d.queryRows(name, func(rows *sql.Rows) error {
+		var word Word
+
+		if err := rows.Scan(&word.Word, &word.NReferences); err != nil {
+			return err
+		}
+
+		if !f(word) {
+			return errStop
+		}
+
+		return nil
+	}, args...)
+}
+
+// Return the strings in the first column of the named query.
+func (d *Database) queryStrings(name string, args ...any) ([]string, error) {
+	var values []string
+
+	err := d.queryRows(name, func(rows *sql.Rows) error {
+		var value string
+
+		if err := rows.Scan(&value); err != nil {
+			return err
+		}
+
+		values = append(values, value)
+		return nil
+	}, args...)
+
+	return values, err
+}
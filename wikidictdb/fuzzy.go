@@ -0,0 +1,112 @@
+package wikidictdb
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// A word found by a fuzzy lookup.
+type Suggestion struct {
+	Word
+
+	// Headword of the word, which is what Distance is measured to. See
+	// wikidictools.DictionaryEntry.Headword.
+	Headword string `json:"-"`
+
+	// Edit distance to the word that was looked up, ignoring case. See
+	// wikidictools.EditDistance.
+	Distance int `json:"distance"`
+}
+
+// Return up to limit words within edit distance maxDistance of word,
+// ignoring case. Closer words come first; words at the same distance are
+// ordered by number of references. The word itself is part of the results
+// if it is in the database. Distances are measured to the headword, so the
+// namespace in titles like "Reconstruction:..." does not count. Fails if
+// maxDistance is larger than wikidictools.FUZZY_MAX_DISTANCE or limit is
+// negative. Needs schema version 11.
+func (d *Database) Suggest(word string, maxDistance int, limit int) ([]Suggestion, error) {
+	if maxDistance < 0 || maxDistance > wikidictools.FUZZY_MAX_DISTANCE {
+		return nil, errors.Errorf("edit distance has to be between 0 and %v", wikidictools.FUZZY_MAX_DISTANCE)
+	}
+
+	if limit < 0 {
+		return nil, errors.New("limit must not be negative")
+	}
+
+	// All words within the distance share at least one variant with word
+	// in the deletion index. Some of the words we find that way are too
+	// far away though.
+
+	variants := wikidictools.DeleteVariants(word, maxDistance, wikidictools.FUZZY_PREFIX_LENGTH)
+
+	lower := strings.ToLower(word)
+	seen := make(map[string]bool)
+	suggestions := []Suggestion{}
+
+	for _, variant := range variants {
+		err := d.queryRows("deleteVariant", func(rows *sql.Rows) error {
+			var (
+				candidate Word
+				entry     wikidictools.DictionaryEntry
+				form      sql.NullString
+			)
+
+			if err := rows.Scan(&candidate.Word, &candidate.NReferences, &entry.Namespace, &form); err != nil {
+				return err
+			}
+
+			if seen[candidate.Word] {
+				return nil
+			}
+
+			seen[candidate.Word] = true
+
+			// The deletion index was built from the headword, not from the
+			// title with its namespace.
+
+			entry.Word = candidate.Word
+
+			if form.Valid {
+				entry.Reconstruction = &wikidictools.Reconstruction{Form: form.String}
+			}
+
+			headword := entry.Headword()
+			distance := wikidictools.EditDistance(lower, strings.ToLower(headword))
+
+			if distance <= maxDistance {
+				suggestions = append(suggestions, Suggestion{Word: candidate, Headword: headword, Distance: distance})
+			}
+
+			return nil
+		}, variant)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "could not look up suggestions")
+		}
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+
+		if a.NReferences != b.NReferences {
+			return a.NReferences > b.NReferences
+		}
+
+		return a.Word.Word < b.Word.Word
+	})
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions, nil
+}
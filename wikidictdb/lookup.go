@@ -0,0 +1,251 @@
+package wikidictdb
+
+import (
+	"database/sql"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Return the entry for word, matched exactly. Definitions, inflections,
+// labels, pronunciations and, for reconstructed words, the reconstruction
+// with its descendants are filled in. Alternative forms are not stored in
+// the database. Returns ErrNotFound if there is no such word; Normalized
+// finds words spelled slightly differently.
+//
+// Files migrated from schema versions before 6 do not know the part of
+// speech of their definitions. Lookup returns those as nouns. Whatever
+// files at older schema versions do not store, like pronunciations before
+// version 7 or keys before version 13, is left empty.
+func (d *Database) Lookup(word string) (*wikidictools.DictionaryEntry, error) {
+	var (
+		entry  wikidictools.DictionaryEntry
+		wordId int64
+	)
+
+	err := d.statements["word"].QueryRow(word).Scan(&wordId, &entry.Word, &entry.Revision, &entry.Namespace)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "could not look up word")
+	}
+
+	if d.supports("key") {
+		if err := d.statements["key"].QueryRow(wordId).Scan(&entry.Key); err != nil {
+			return nil, errors.Wrap(err, "could not look up key")
+		}
+	}
+
+	if d.supports("properNoun") {
+		if err := d.statements["properNoun"].QueryRow(wordId).Scan(&entry.ProperNoun); err != nil {
+			return nil, errors.Wrap(err, "could not look up proper noun")
+		}
+	}
+
+	if err := d.fillDefinitions(&entry, wordId); err != nil {
+		return nil, err
+	}
+
+	if d.supports("pronunciations") {
+		if entry.Pronunciations, err = d.queryStrings("pronunciations", wordId); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.supports("inflections") {
+		if entry.Inflections, err = d.queryStrings("inflections", wordId); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.supports("labels") {
+		if entry.Labels, err = d.queryStrings("labels", wordId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.fillReconstruction(&entry, wordId); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// Return whether word is in the database, matched exactly.
+func (d *Database) HasWord(word string) (bool, error) {
+	_, err := d.NReferences(word)
+
+	switch err {
+	case nil:
+		return true, nil
+	case ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Return the number of links from definitions to word. Returns ErrNotFound
+// if there is no such word.
+func (d *Database) NReferences(word string) (int64, error) {
+	var nreferences int64
+
+	err := d.statements["nreferences"].QueryRow(word).Scan(&nreferences)
+
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, errors.Wrap(err, "could not look up word")
+	}
+
+	return nreferences, nil
+}
+
+// Return the PageRank of word over the links in all definitions, scaled
+// so that the average word has a score of 1. Unlike the number of
+// references, links from important words count more than others. Returns
+// ErrNotFound if there is no such word. Needs schema version 14.
+func (d *Database) Score(word string) (float64, error) {
+	var score float64
+
+	statement, err := d.statement("score")
+	if err != nil {
+		return 0, err
+	}
+
+	err = statement.QueryRow(word).Scan(&score)
+
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, errors.Wrap(err, "could not look up word")
+	}
+
+	return score, nil
+}
+
+// Return whether the database has scores, i.e. whether it is at schema
+// version 14 or later. Score fails on files without scores.
+func (d *Database) HasScores() bool {
+	return d.supports("score")
+}
+
+// Return the synonym sets from the Thesaurus with the given headword. The
+// database only contains those if it was created with the Thesaurus
+// namespace. Returns ErrNotFound if there are no sets for headword.
+func (d *Database) Thesaurus(headword string) (*wikidictools.Thesaurus, error) {
+	thesaurus := wikidictools.Thesaurus{
+		Headword: headword,
+	}
+
+	var setIds []int64
+
+	err := d.queryRows("synonymSets", func(rows *sql.Rows) error {
+		var (
+			set   wikidictools.SynonymSet
+			setId int64
+		)
+
+		if err := rows.Scan(&setId, &set.PartOfSpeech, &set.Sense, &set.Gloss, &set.Relation); err != nil {
+			return err
+		}
+
+		thesaurus.Sets = append(thesaurus.Sets, set)
+		setIds = append(setIds, setId)
+
+		return nil
+	}, headword)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(thesaurus.Sets) == 0 {
+		return nil, ErrNotFound
+	}
+
+	for i, setId := range setIds {
+		set := &thesaurus.Sets[i]
+
+		err := d.queryRows("synonyms", func(rows *sql.Rows) error {
+			var word string
+
+			if err := rows.Scan(&word); err != nil {
+				return err
+			}
+
+			set.Words = append(set.Words, word)
+			return nil
+		}, setId)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &thesaurus, nil
+}
+
+func (d *Database) fillDefinitions(entry *wikidictools.DictionaryEntry, wordId int64) error {
+	return d.queryRows("definitions", func(rows *sql.Rows) error {
+		var partOfSpeech, definition string
+
+		if err := rows.Scan(&partOfSpeech, &definition); err != nil {
+			return err
+		}
+
+		switch partOfSpeech {
+		case "verb":
+			entry.Verb = append(entry.Verb, definition)
+		case "adjective":
+			entry.Adjective = append(entry.Adjective, definition)
+		case "adverb":
+			entry.Adverb = append(entry.Adverb, definition)
+		case "phrase":
+			entry.Phrase = append(entry.Phrase, definition)
+		default:
+			entry.Noun = append(entry.Noun, definition)
+		}
+
+		return nil
+	}, wordId)
+}
+
+func (d *Database) fillReconstruction(entry *wikidictools.DictionaryEntry, wordId int64) error {
+	var reconstruction wikidictools.Reconstruction
+
+	err := d.statements["reconstruction"].QueryRow(wordId).Scan(&reconstruction.Language, &reconstruction.Form)
+
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "could not look up reconstruction")
+	}
+
+	err = d.queryRows("descendants", func(rows *sql.Rows) error {
+		var descendant wikidictools.Descendant
+
+		if err := rows.Scan(&descendant.Depth, &descendant.Language, &descendant.Word, &descendant.Tree); err != nil {
+			return err
+		}
+
+		reconstruction.Descendants = append(reconstruction.Descendants, descendant)
+		return nil
+	}, wordId)
+
+	if err != nil {
+		return err
+	}
+
+	entry.Reconstruction = &reconstruction
+	return nil
+}
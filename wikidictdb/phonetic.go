@@ -0,0 +1,65 @@
+package wikidictdb
+
+import (
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictools"
+)
+
+// A phonetic key stored for each word. Words with the same key sound
+// alike.
+type PhoneticKey int
+
+const (
+	// American Soundex, see wikidictools.Soundex.
+	SoundexKey PhoneticKey = iota
+
+	// Primary or alternate Double Metaphone code, see
+	// wikidictools.DoubleMetaphone. Two words match if any of their codes
+	// are the same.
+	MetaphoneKey
+
+	// Key of the first IPA transcription of a word, see
+	// wikidictools.IpaKey. Only words with pronunciations have one.
+	IpaKey
+)
+
+// Names of phonetic keys as used by PhoneticKeyNamed.
+var phoneticKeyNames = map[string]PhoneticKey{
+	"soundex":   SoundexKey,
+	"metaphone": MetaphoneKey,
+	"ipa":       IpaKey,
+}
+
+// Return the phonetic key with name "soundex", "metaphone" or "ipa".
+func PhoneticKeyNamed(name string) (PhoneticKey, bool) {
+	key, ok := phoneticKeyNames[strings.ToLower(name)]
+	return key, ok
+}
+
+// Return up to limit words that sound like word according to key, ordered
+// by number of references and skipping the first offset. For IpaKey, word
+// is either an IPA transcription in slashes or brackets, e.g. "/dɒɡ/", or
+// a word from the database whose first pronunciation is used. Needs
+// schema version 10.
+func (d *Database) SoundsLike(word string, key PhoneticKey, limit, offset int) ([]Word, error) {
+	switch key {
+	case SoundexKey:
+		return d.queryWords("soundex", wikidictools.Soundex(word), limit, offset)
+	case MetaphoneKey:
+		primary, alternate := wikidictools.DoubleMetaphone(word)
+		return d.queryWords("metaphone", primary, alternate, limit, offset)
+	default:
+		if isTranscription(word) {
+			return d.queryWords("ipa", wikidictools.IpaKey(word), limit, offset)
+		}
+
+		return d.queryWords("ipaOfWord", word, limit, offset)
+	}
+}
+
+// Return whether word is an IPA transcription in slashes or brackets
+// rather than a word from the database.
+func isTranscription(word string) bool {
+	return strings.HasPrefix(word, "/") || strings.HasPrefix(word, "[")
+}
@@ -0,0 +1,147 @@
+package wikidictdb
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/kissen/wikidictools/wikidictools"
+)
+
+// Order in which FindWords returns words.
+type WordOrder int
+
+const (
+	// In byte order of the words.
+	ByWord WordOrder = iota
+
+	// Most referenced words first.
+	ByReferences
+
+	// Highest scored words first. See Database.Score.
+	ByScore
+)
+
+// Names of orders as used by WordOrderNamed.
+var wordOrderNames = map[string]WordOrder{
+	"word":       ByWord,
+	"references": ByReferences,
+	"score":      ByScore,
+}
+
+// Return the order with name "word", "references" or "score".
+func WordOrderNamed(name string) (WordOrder, bool) {
+	order, ok := wordOrderNames[strings.ToLower(name)]
+	return order, ok
+}
+
+// Criteria for FindWords. Words have to meet all criteria that are set;
+// the zero value matches every word.
+type WordQuery struct {
+	// Pattern the whole word has to match. "?" stands for any single
+	// character, "*" for any number of characters and "[abc]" for one of
+	// the listed characters, e.g. "?a?e?" for "water" or "cater".
+	// Matching is case-sensitive.
+	Pattern string
+
+	// Regular expression that has to match the word. Use ^ and $ to match
+	// the whole word.
+	Regexp *regexp.Regexp
+
+	// Minimum and maximum length of the word in characters. Zero means no
+	// limit.
+	MinLength int
+	MaxLength int
+
+	// Parts of speech like "noun" of which the word needs at least one
+	// definition.
+	PartsOfSpeech []string
+
+	// Leave out words that have definitions as proper nouns only.
+	NoProperNouns bool
+
+	// Only match words with at least this many references.
+	MinReferences int64
+
+	// Only match anagrams of this word, including the word itself. See
+	// wikidictools.SortedLetters.
+	Anagram string
+
+	// Only match words that sound like this word according to Phonetic.
+	// See Database.SoundsLike.
+	SoundsLike string
+	Phonetic   PhoneticKey
+
+	// Order of the results. The zero value is byte order.
+	Order WordOrder
+}
+
+// Run function f on each word that matches query, in query.Order. If f
+// returns true, FindWords keeps iterating. If f returns false, iteration
+// stops. Needs schema version 10, or 14 to order by score.
+func (d *Database) FindWords(query *WordQuery, f func(word Word) bool) error {
+	// Everything except for regular expressions translates to parameters
+	// of a single query. Criteria that are not set are NULL and match
+	// every word. This looks at every word.
+
+	args := make([]any, 12)
+
+	if query.Pattern != "" {
+		args[0] = query.Pattern
+	}
+
+	if query.MinLength > 0 {
+		args[1] = query.MinLength
+	}
+
+	if query.MaxLength > 0 {
+		args[2] = query.MaxLength
+	}
+
+	if query.NoProperNouns {
+		args[3] = true
+	}
+
+	if query.MinReferences > 0 {
+		args[4] = query.MinReferences
+	}
+
+	if query.Anagram != "" {
+		args[5] = wikidictools.SortedLetters(query.Anagram)
+	}
+
+	if len(query.PartsOfSpeech) > 0 {
+		args[6] = "," + strings.Join(query.PartsOfSpeech, ",") + ","
+	}
+
+	if query.SoundsLike != "" {
+		switch query.Phonetic {
+		case SoundexKey:
+			args[7] = wikidictools.Soundex(query.SoundsLike)
+		case MetaphoneKey:
+			args[8], args[9] = wikidictools.DoubleMetaphone(query.SoundsLike)
+		default:
+			if isTranscription(query.SoundsLike) {
+				args[10] = wikidictools.IpaKey(query.SoundsLike)
+			} else {
+				args[11] = query.SoundsLike
+			}
+		}
+	}
+
+	name := "findByWord"
+
+	switch query.Order {
+	case ByReferences:
+		name = "findByReferences"
+	case ByScore:
+		name = "findByScore"
+	}
+
+	return d.forEachWord(name, func(word Word) bool {
+		if query.Regexp != nil && !query.Regexp.MatchString(word.Word) {
+			return true
+		}
+
+		return f(word)
+	}, args...)
+}
@@ -0,0 +1,145 @@
+package wikidictdb
+
+import (
+	"database/sql"
+
+	"github.com/kissen/wikidictools/wikidictools"
+	"github.com/pkg/errors"
+)
+
+// Return up to limit words that start with prefix, in byte order, skipping
+// the first offset matches.
+func (d *Database) Prefix(prefix string, limit, offset int) ([]Word, error) {
+	if prefix == "" {
+		return d.queryWords("all", limit, offset)
+	}
+
+	// Comparing against the range of all strings with the prefix lets
+	// SQLite use the index on words.
+
+	return d.queryWords("prefix", prefix, prefixUpperBound(prefix), limit, offset)
+}
+
+// Return up to limit words that start with prefix, ignoring case and
+// diacritics, for autocompletion. The most referenced words come first.
+// See wikidictools.FoldWord. Fails if limit is negative. Needs schema
+// version 12.
+func (d *Database) Complete(prefix string, limit int) ([]Word, error) {
+	if limit < 0 {
+		return nil, errors.New("limit must not be negative")
+	}
+
+	folded := wikidictools.FoldWord(prefix)
+
+	if folded == "" {
+		return d.MostReferenced(limit, 0)
+	}
+
+	// Like Prefix, this is a range scan over an index. Short prefixes
+	// match many words which all need to be sorted by references though.
+
+	return d.queryWords("complete", folded, prefixUpperBound(folded), limit)
+}
+
+// Return all words with the same lookup key as word, most referenced
+// first, e.g. "don’t" for "Don't". This finds words that differ from word
+// in case, Unicode normalization or the kind of apostrophes and dashes.
+// See wikidictools.NormalizeWord. Files before schema version 13 have no
+// keys; for those, only word itself is found.
+func (d *Database) Normalized(word string) ([]Word, error) {
+	if !d.supports("normalized") {
+		return d.queryWords("exact", word)
+	}
+
+	return d.queryWords("normalized", wikidictools.NormalizeWord(word, d.stripDiacritics))
+}
+
+// Return up to limit words that contain substring, in byte order, skipping
+// the first offset matches. This has to look at every word.
+func (d *Database) Substring(substring string, limit, offset int) ([]Word, error) {
+	return d.queryWords("substring", substring, limit, offset)
+}
+
+// Return up to limit words whose definitions match the full-text query,
+// skipping the first offset matches. See the SQLite documentation on FTS4
+// for the query syntax. Words are ordered by number of references.
+func (d *Database) Search(query string, limit, offset int) ([]Word, error) {
+	return d.queryWords("search", query, limit, offset)
+}
+
+// Return up to limit words ordered by number of references, skipping the
+// first offset.
+func (d *Database) MostReferenced(limit, offset int) ([]Word, error) {
+	return d.queryWords("mostReferenced", limit, offset)
+}
+
+// Return up to limit words ordered by score, skipping the first offset.
+// See Score. Needs schema version 14.
+func (d *Database) HighestScored(limit, offset int) ([]Word, error) {
+	return d.queryWords("highestScored", limit, offset)
+}
+
+// Return all words made up of the same letters as word, in byte order,
+// including word itself if it is in the database. Case, diacritics and
+// characters other than letters do not count; see
+// wikidictools.SortedLetters. This is a single lookup in the index on
+// sorted letters. Needs schema version 9.
+func (d *Database) Anagrams(word string) ([]Word, error) {
+	return d.queryWords("anagrams", wikidictools.SortedLetters(word))
+}
+
+// Return a random word. Returns ErrNotFound if the database is empty.
+func (d *Database) RandomWord() (string, error) {
+	var word string
+
+	err := d.statements["random"].QueryRow().Scan(&word)
+
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+
+	if err != nil {
+		return "", errors.Wrap(err, "could not pick random word")
+	}
+
+	return word, nil
+}
+
+// Run function f on each word in the database, in byte order. If f returns
+// true, ForEachWord keeps iterating. If f returns false, iteration stops.
+func (d *Database) ForEachWord(f func(word Word) bool) error {
+	return d.forEachWord("everyWord", f)
+}
+
+// Return the smallest string that is greater than all strings with the
+// given non-empty prefix when comparing bytes.
+func prefixUpperBound(prefix string) string {
+	// UTF-8 never contains 0xff, so incrementing the last byte never
+	// overflows.
+
+	bound := []byte(prefix)
+	bound[len(bound)-1] += 1
+
+	return string(bound)
+}
+
+// Run function f on each link in the definitions of all words, with the
+// word whose definition has the link as source and the page it points to
+// as target, e.g. "man" for "[[man|guy]]". Sources come in byte order.
+// Targets need not be in the database. If f returns true, ForEachLink keeps
+// iterating. If f returns false, iteration stops. Needs schema version 15.
+func (d *Database) ForEachLink(f func(source, target string) bool) error {
+	return d.queryRows("everyLink", func(rows *sql.Rows) error {
+		var source, target string
+
+		if err := rows.Scan(&source, &target); err != nil {
+			return err
+		}
+
+		if !f(source, target) {
+			return errStop
+		}
+
+		return nil
+	})
+}
@@ -1,5 +1,27 @@
 package wikidictools
 
+import "strings"
+
+// Return the word this entry is about without the namespace of its page,
+// e.g. "wódr̥" for "Reconstruction:Proto-Indo-European/wódr̥". Keys for
+// looking up words by their spelling or sound are derived from this.
+func (e *DictionaryEntry) Headword() string {
+	if e.Reconstruction != nil {
+		return e.Reconstruction.Form
+	}
+
+	// Titles of pages outside the main namespace start with the name of
+	// their namespace.
+
+	if e.Namespace != 0 {
+		if _, headword, ok := strings.Cut(e.Word, ":"); ok {
+			return headword
+		}
+	}
+
+	return e.Word
+}
+
 // Return whether this entry is empty in that it contains no defintions.
 func (e *DictionaryEntry) IsEmpty() bool {
 	return isEmpty(e.Noun) && isEmpty(e.Verb) && isEmpty(e.Adjective) && isEmpty(e.Adverb) && isEmpty(e.Phrase)
@@ -22,6 +44,30 @@ func (e *DictionaryEntry) ForEachDefintion(f func(string) bool) {
 	}
 }
 
+// Run function f on each part of speech with at least one definition in
+// this dictionary entry, in the order noun, verb, adjective, adverb and
+// phrase. Function f gets the lower case name of the part of speech and
+// its definitions. If f returns true, ForEachPartOfSpeech keeps iterating.
+// If f returns false, iteration stops.
+func (e *DictionaryEntry) ForEachPartOfSpeech(f func(partOfSpeech string, definitions []string) bool) {
+	choices := []struct {
+		name        string
+		definitions []string
+	}{
+		{"noun", e.Noun}, {"verb", e.Verb}, {"adjective", e.Adjective}, {"adverb", e.Adverb}, {"phrase", e.Phrase},
+	}
+
+	for _, choice := range choices {
+		if isEmpty(choice.definitions) {
+			continue
+		}
+
+		if !f(choice.name, choice.definitions) {
+			return
+		}
+	}
+}
+
 func isEmpty(slice []string) bool {
 	return len(slice) == 0
 }
@@ -0,0 +1,53 @@
+package wikidictools
+
+import "strings"
+
+// Return a single line of an "Etymology" section as plain text, e.g.
+// "From {{inh|en|enm|dogge}}." becomes "From dogge.". Templates that do
+// not name a word are dropped.
+func parseEtymology(line string) string {
+	var text strings.Builder
+
+	for {
+		start := strings.Index(line, "{{")
+		if start == -1 {
+			break
+		}
+
+		end := matchingBracesEnd(line, start)
+		if end == -1 {
+			break
+		}
+
+		text.WriteString(line[:start])
+		text.WriteString(etymologyTemplateText(parseTemplate(line[start+2 : end-2])))
+
+		line = line[end:]
+	}
+
+	text.WriteString(line)
+
+	return strings.Join(strings.Fields(StripLinksFrom(cleanBracketsFrom(text.String()))), " ")
+}
+
+// Return the word named by template t as used in etymologies.
+func etymologyTemplateText(t template) string {
+	var term, alt string
+
+	switch t.name {
+	case "inh", "inh+", "der", "der+", "bor", "bor+", "lbor", "slbor", "uder", "ubor", "cal", "calque", "sl", "semantic loan":
+		// Language of the entry, source language, word, alternative text.
+		term, alt = t.arg(2), t.arg(3)
+	case "m", "mention", "l", "link", "cog", "cognate", "noncog", "noncognate":
+		// Language, word, alternative text.
+		term, alt = t.arg(1), t.arg(2)
+	default:
+		return ""
+	}
+
+	if alt != "" {
+		return alt
+	}
+
+	return term
+}
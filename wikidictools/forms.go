@@ -0,0 +1,38 @@
+package wikidictools
+
+import "strings"
+
+// Return all spellings listed on a single line of an "Alternative forms"
+// section, e.g. "* {{alter|en|dogge|doggy}}" or "* {{l|en|dogge}}".
+func parseAlternativeForms(line string) (forms []string) {
+	if listIndentLevel(line) == 0 {
+		return nil
+	}
+
+	for _, t := range findTemplates(line) {
+		switch t.name {
+		case "alter", "alt":
+			// After the language come the forms. An empty argument ends
+			// the forms; what follows are dialect labels.
+
+			for i := 1; i < len(t.positional) && t.positional[i] != ""; i++ {
+				forms = append(forms, t.positional[i])
+			}
+		case "l", "l-self":
+			if form := t.arg(1); form != "" {
+				forms = append(forms, form)
+			}
+		}
+	}
+
+	// Some pages just link to the other forms.
+
+	if len(forms) == 0 {
+		for _, link := range GetLinksFrom(line) {
+			target, _, _ := strings.Cut(link, "|")
+			forms = append(forms, target)
+		}
+	}
+
+	return forms
+}
@@ -0,0 +1,117 @@
+package wikidictools
+
+import "strings"
+
+// Maximum edit distance of the deletion index of wdictosqlite. Lookups
+// with a larger distance would miss words.
+const FUZZY_MAX_DISTANCE = 2
+
+// Only this many characters at the start of a word go into the deletion
+// index. Longer words share variants with their prefix, which keeps the
+// index small.
+const FUZZY_PREFIX_LENGTH = 7
+
+// Return all strings that result from deleting up to maxDistance characters
+// from the first prefixLength characters of word in lower case, including
+// that prefix itself. Two words within edit distance maxDistance of each
+// other always have at least one variant in common; this is the idea behind
+// the SymSpell algorithm.
+func DeleteVariants(word string, maxDistance int, prefixLength int) []string {
+	runes := []rune(strings.ToLower(word))
+
+	if len(runes) > prefixLength {
+		runes = runes[:prefixLength]
+	}
+
+	variants := map[string]bool{string(runes): true}
+	current := [][]rune{runes}
+
+	for distance := 1; distance <= maxDistance; distance++ {
+		var next [][]rune
+
+		for _, variant := range current {
+			for i := range variant {
+				deleted := make([]rune, 0, len(variant)-1)
+				deleted = append(deleted, variant[:i]...)
+				deleted = append(deleted, variant[i+1:]...)
+
+				if key := string(deleted); !variants[key] {
+					variants[key] = true
+					next = append(next, deleted)
+				}
+			}
+		}
+
+		current = next
+	}
+
+	result := make([]string, 0, len(variants))
+
+	for variant := range variants {
+		result = append(result, variant)
+	}
+
+	return result
+}
+
+// Return the Damerau-Levenshtein distance between a and b, that is the
+// number of insertions, deletions, substitutions and transpositions of
+// adjacent characters it takes to turn a into b. As usual, no substring is
+// edited twice.
+func EditDistance(a, b string) int {
+	return editDistance(a, b, true)
+}
+
+// Return the Levenshtein distance between a and b, that is the number of
+// insertions, deletions and substitutions it takes to turn a into b. Unlike
+// with EditDistance, swapping two characters counts as two edits.
+func LevenshteinDistance(a, b string) int {
+	return editDistance(a, b, false)
+}
+
+func editDistance(a, b string, transpositions bool) int {
+	s, t := []rune(a), []rune(b)
+
+	// We keep the last three rows of the matrix only.
+
+	previous2 := make([]int, len(t)+1)
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+
+			if transpositions && i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				current[j] = minInt(current[j], previous2[j-2]+1)
+			}
+		}
+
+		previous2, previous, current = previous, current, previous2
+	}
+
+	return previous[len(t)]
+}
+
+// Return the smallest of values.
+func minInt(first int, rest ...int) int {
+	for _, value := range rest {
+		if value < first {
+			first = value
+		}
+	}
+
+	return first
+}
@@ -19,3 +19,26 @@ func GetLinksFrom(definition string) (links []string) {
 
 	return links
 }
+
+// Given the wikitext of a definition, return the pages its [[links]] point
+// to, e.g. "man" for "[[man|guy]]". Links to sections of other pages name
+// the page only; links to sections of the same page are left out. Unlike
+// GetLinksFrom, this does not work on definitions that were cleaned up
+// already, as those only keep the text of each link.
+func GetLinkTargetsFrom(text string) (targets []string) {
+	for _, link := range _DEFINITION_LINK_PATTERN.FindAllStringSubmatch(text, -1) {
+		target, _, _ := strings.Cut(link[1], "|")
+		target, _, _ = strings.Cut(target, "#")
+
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+
+	return targets
+}
+
+// Given definition, return it with all [[links]] replaced by their text.
+func StripLinksFrom(definition string) string {
+	return _DEFINITION_LINK_PATTERN.ReplaceAllString(definition, "$1")
+}
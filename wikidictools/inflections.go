@@ -0,0 +1,183 @@
+package wikidictools
+
+import "strings"
+
+// Return the inflected forms of word given by the English headword
+// template on line, e.g. "{{en-noun}}" or "{{en-verb|dogg|ed}}". Only the
+// most common ways of using the templates are understood. Forms that are
+// not given explicitly are derived with the regular English rules.
+func parseInflections(word string, line string) []string {
+	if t, ok := findTemplate(line, "en-noun"); ok {
+		return englishNounForms(word, &t)
+	}
+
+	if t, ok := findTemplate(line, "en-verb"); ok {
+		return englishVerbForms(word, &t)
+	}
+
+	if t, ok := findTemplate(line, "en-adj", "en-adv"); ok {
+		return englishComparisonForms(word, &t)
+	}
+
+	return nil
+}
+
+// Return the plurals given by an {{en-noun}} template.
+func englishNounForms(word string, t *template) (forms []string) {
+	if len(t.positional) == 0 {
+		return []string{englishSuffixS(word)}
+	}
+
+	for _, arg := range t.positional {
+		switch arg {
+		case "", "+", "~":
+			forms = append(forms, englishSuffixS(word))
+		case "s", "es":
+			forms = append(forms, word+arg)
+		case "ies":
+			forms = append(forms, strings.TrimSuffix(word, "y")+arg)
+		case "-", "!", "?":
+			// Uncountable or the plural is unknown.
+		default:
+			forms = append(forms, arg)
+		}
+	}
+
+	return forms
+}
+
+// Return the third-person singular, present participle, past and past
+// participle given by an {{en-verb}} template.
+func englishVerbForms(word string, t *template) []string {
+	// By default, all forms are regular.
+
+	forms := []string{
+		englishSuffixS(word),
+		englishSuffixIng(word),
+		englishSuffixEd(word),
+		englishSuffixEd(word),
+	}
+
+	// The old style gives a stem and an ending, e.g. {{en-verb|dogg|ed}}.
+	// Otherwise, each argument replaces one of the forms. The past
+	// participle defaults to the past.
+
+	switch stem := t.arg(0); {
+	case len(t.positional) >= 2 && t.arg(1) == "es":
+		forms = []string{stem + "es", stem + "ing", stem + "ed", stem + "ed"}
+	case len(t.positional) >= 2 && t.arg(1) == "ies":
+		forms = []string{stem + "ies", stem + "ying", stem + "ied", stem + "ied"}
+	case len(t.positional) >= 2 && (t.arg(1) == "ed" || t.arg(1) == "d"):
+		forms[1], forms[2], forms[3] = stem+"ing", stem+t.arg(1), stem+t.arg(1)
+	case len(t.positional) >= 2 && t.arg(1) == "ing":
+		forms[1] = stem + "ing"
+
+		if past := t.arg(2); past != "" {
+			forms[2], forms[3] = past, past
+		}
+
+		if participle := t.arg(3); participle != "" {
+			forms[3] = participle
+		}
+	default:
+		for i, arg := range t.positional {
+			if i < len(forms) && arg != "" && arg != "+" {
+				forms[i] = arg
+
+				if i == 2 && t.arg(3) == "" {
+					forms[3] = arg
+				}
+			}
+		}
+	}
+
+	return appendUnique(nil, forms...)
+}
+
+// Return the comparative and superlative given by an {{en-adj}} or
+// {{en-adv}} template. Words compared with "more" and "most" have no
+// inflected forms.
+func englishComparisonForms(word string, t *template) (forms []string) {
+	for i, arg := range t.positional {
+		switch arg {
+		case "er":
+			forms = append(forms, englishSuffixEr(word, "r"), englishSuffixEr(word, "st"))
+		case "more", "further", "-", "?", "":
+			// Not comparable or periphrastic.
+		default:
+			// Explicit comparatives may be followed by their superlative
+			// in the named argument "sup", otherwise we derive it.
+
+			forms = append(forms, arg)
+
+			if superlative := t.named["sup"]; superlative != "" && i == 0 {
+				forms = append(forms, superlative)
+			} else if strings.HasSuffix(arg, "er") {
+				forms = append(forms, strings.TrimSuffix(arg, "r")+"st")
+			}
+		}
+	}
+
+	return appendUnique(nil, forms...)
+}
+
+// Return word with the regular English "-s" ending.
+func englishSuffixS(word string) string {
+	for _, sibilant := range []string{"s", "x", "z", "ch", "sh"} {
+		if strings.HasSuffix(word, sibilant) {
+			return word + "es"
+		}
+	}
+
+	if endsInConsonantY(word) {
+		return word[:len(word)-1] + "ies"
+	}
+
+	return word + "s"
+}
+
+// Return word with the regular English "-ing" ending.
+func englishSuffixIng(word string) string {
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "ee") && len(word) > 2 {
+		return word[:len(word)-1] + "ing"
+	}
+
+	return word + "ing"
+}
+
+// Return word with the regular English "-ed" ending.
+func englishSuffixEd(word string) string {
+	if strings.HasSuffix(word, "e") {
+		return word + "d"
+	}
+
+	if endsInConsonantY(word) {
+		return word[:len(word)-1] + "ied"
+	}
+
+	return word + "ed"
+}
+
+// Return word with the regular English "-er" ending if ending is "r" or
+// the "-est" ending if ending is "st".
+func englishSuffixEr(word string, ending string) string {
+	if strings.HasSuffix(word, "e") {
+		return word + ending
+	}
+
+	if endsInConsonantY(word) {
+		return word[:len(word)-1] + "ie" + ending
+	}
+
+	return word + "e" + ending
+}
+
+// Return whether word ends in a consonant followed by "y", e.g. "fly" but
+// not "day".
+func endsInConsonantY(word string) bool {
+	if len(word) < 2 || !strings.HasSuffix(word, "y") {
+		return false
+	}
+
+	return !strings.ContainsRune("aeiou", rune(word[len(word)-2]))
+}
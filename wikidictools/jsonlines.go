@@ -0,0 +1,78 @@
+package wikidictools
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Reads dictionary entries from JSON Lines files, that is files with one
+// JSON encoded DictionaryEntry per line, as written by "wdictosqlite -format
+// jsonl".
+type JsonLinesReader struct {
+	reader  io.ReadCloser
+	decoder *json.Decoder
+}
+
+// Only used to get the default encoding of DictionaryEntry without
+// recursing into its own MarshalJSON and UnmarshalJSON methods.
+type plainDictionaryEntry DictionaryEntry
+
+// Encode the entry as a single JSON object. Fields are named as in the
+// json tags of DictionaryEntry; empty optional fields are left out.
+// Returns an error if the entry has no word.
+func (e DictionaryEntry) MarshalJSON() ([]byte, error) {
+	if e.Word == "" {
+		return nil, errors.New("dictionary entry has no word")
+	}
+
+	return json.Marshal(plainDictionaryEntry(e))
+}
+
+// Decode an entry encoded with MarshalJSON. Unknown fields are ignored so
+// that readers keep working when fields get added. Returns an error if the
+// object has no word.
+func (e *DictionaryEntry) UnmarshalJSON(data []byte) error {
+	var decoded plainDictionaryEntry
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	if decoded.Word == "" {
+		return errors.New("dictionary entry has no word")
+	}
+
+	*e = DictionaryEntry(decoded)
+	return nil
+}
+
+// Create new JsonLinesReader for the given stream.
+func NewJsonLinesReader(rx io.ReadCloser) *JsonLinesReader {
+	return &JsonLinesReader{
+		reader:  rx,
+		decoder: json.NewDecoder(bufio.NewReader(rx)),
+	}
+}
+
+// Return the next entry from the stream. Just like XmlParser.Next, returns
+// (nil, io.EOF) once all entries were read.
+func (jr *JsonLinesReader) Next() (*DictionaryEntry, error) {
+	var entry DictionaryEntry
+
+	if err := jr.decoder.Decode(&entry); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+
+		return nil, errors.Wrap(err, "could not decode entry")
+	}
+
+	return &entry, nil
+}
+
+func (jr *JsonLinesReader) Close() error {
+	return jr.reader.Close()
+}
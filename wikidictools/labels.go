@@ -0,0 +1,41 @@
+package wikidictools
+
+import "strings"
+
+// Return the labels given with {{lb}} on a single definition line in lower
+// case, e.g. ["slang", "offensive"] for "# {{lb|en|slang|offensive}} A
+// [[man]].". Words that join labels, like "_" and "or", are left out.
+func parseLabels(line string) (labels []string) {
+	for _, t := range findTemplates(line) {
+		if t.name != "lb" && t.name != "lbl" && t.name != "label" {
+			continue
+		}
+
+		// After the language come the labels.
+
+		for i := 1; i < len(t.positional); i++ {
+			switch label := strings.ToLower(strings.TrimSpace(t.positional[i])); label {
+			case "", "_", "and", "or":
+				continue
+			default:
+				labels = appendUnique(labels, label)
+			}
+		}
+	}
+
+	return labels
+}
+
+// Return the values that are part of both a and b, in the order of a.
+func Intersect(a, b []string) (both []string) {
+	for _, value := range a {
+		for _, other := range b {
+			if value == other {
+				both = append(both, value)
+				break
+			}
+		}
+	}
+
+	return both
+}
@@ -0,0 +1,31 @@
+package wikidictools
+
+import (
+	"sort"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Return the letters of word in lower case without diacritics, sorted by
+// code point, e.g. "aelrst" for "Alerts" and "acef" for "café". Words
+// that are anagrams of each other have the same sorted letters. Anything
+// but letters is dropped, so "don't" and "dont" are anagrams too.
+func SortedLetters(word string) string {
+	var letters []rune
+
+	// Decomposing splits letters with diacritics into the base letter
+	// and combining marks, which are not letters themselves.
+
+	for _, r := range norm.NFD.String(word) {
+		if unicode.IsLetter(r) {
+			letters = append(letters, unicode.ToLower(r))
+		}
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i] < letters[j]
+	})
+
+	return string(letters)
+}
@@ -0,0 +1,726 @@
+package wikidictools
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Maximum length of Double Metaphone codes.
+const _METAPHONE_LENGTH = 4
+
+// Return the primary and alternate Double Metaphone codes of word, e.g.
+// "SM0" and "XMT" for "Smith". Words with only one likely pronunciation
+// have the same primary and alternate code. Diacritics are stripped, and
+// characters other than the letters A to Z are skipped. Returns empty
+// strings if word contains no such letters.
+//
+// This follows the original algorithm by Lawrence Philips, which was
+// made for English names but works for other English words too.
+func DoubleMetaphone(word string) (primary string, alternate string) {
+	var letters []rune
+
+	for _, r := range norm.NFD.String(word) {
+		if !unicode.Is(unicode.Mn, r) {
+			letters = append(letters, unicode.ToUpper(r))
+		}
+	}
+
+	m := metaphone{
+		word:   letters,
+		length: len(letters),
+		last:   len(letters) - 1,
+	}
+
+	m.encode()
+
+	primary, alternate = m.primary.String(), m.alternate.String()
+
+	if len(primary) > _METAPHONE_LENGTH {
+		primary = primary[:_METAPHONE_LENGTH]
+	}
+
+	if len(alternate) > _METAPHONE_LENGTH {
+		alternate = alternate[:_METAPHONE_LENGTH]
+	}
+
+	return primary, alternate
+}
+
+// State of encoding a single word with DoubleMetaphone.
+type metaphone struct {
+	// The word in upper case.
+	word []rune
+
+	// Number of runes in word and index of the last one.
+	length int
+	last   int
+
+	// Codes built so far.
+	primary   strings.Builder
+	alternate strings.Builder
+}
+
+// Return the rune at index i or a space if i is out of range. Words are
+// treated as if followed by spaces, which some rules look for.
+func (m *metaphone) at(i int) rune {
+	if i < 0 || i >= m.length {
+		return ' '
+	}
+
+	return m.word[i]
+}
+
+// Return whether the runes starting at index start equal one of options.
+// Options may reach past the end of the word, where they can match
+// spaces, but start has to be inside the word.
+func (m *metaphone) stringAt(start int, options ...string) bool {
+	if start < 0 || start > m.last {
+		return false
+	}
+
+	for _, option := range options {
+		matches := true
+		i := start
+
+		for _, r := range option {
+			if m.at(i) != r {
+				matches = false
+				break
+			}
+
+			i += 1
+		}
+
+		if matches {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return whether the rune at index i is a vowel.
+func (m *metaphone) isVowel(i int) bool {
+	if i < 0 || i >= m.length {
+		return false
+	}
+
+	return strings.ContainsRune("AEIOUY", m.word[i])
+}
+
+// Return whether the word looks Slavic or Germanic.
+func (m *metaphone) isSlavoGermanic() bool {
+	word := string(m.word)
+
+	return strings.ContainsAny(word, "WK") || strings.Contains(word, "CZ")
+}
+
+// Add code to both the primary and the alternate code.
+func (m *metaphone) add(code string) {
+	m.primary.WriteString(code)
+	m.alternate.WriteString(code)
+}
+
+// Add different codes to the primary and the alternate code.
+func (m *metaphone) addBoth(primary, alternate string) {
+	m.primary.WriteString(primary)
+	m.alternate.WriteString(alternate)
+}
+
+// Return 2 if the rune at index next is r, otherwise 1. Used to skip
+// doubled letters.
+func (m *metaphone) skipDouble(next int, r rune) int {
+	if m.at(next) == r {
+		return 2
+	}
+
+	return 1
+}
+
+func (m *metaphone) encode() {
+	current := 0
+
+	// Skip these when at the start of a word.
+
+	if m.stringAt(0, "GN", "KN", "PN", "WR", "PS") {
+		current += 1
+	}
+
+	// An initial X is pronounced Z, e.g. "Xavier".
+
+	if m.at(0) == 'X' {
+		m.add("S")
+		current += 1
+	}
+
+	for current < m.length {
+		if m.primary.Len() >= _METAPHONE_LENGTH && m.alternate.Len() >= _METAPHONE_LENGTH {
+			break
+		}
+
+		switch m.at(current) {
+		case 'A', 'E', 'I', 'O', 'U', 'Y':
+			// Vowels are only kept at the start.
+
+			if current == 0 {
+				m.add("A")
+			}
+
+			current += 1
+		case 'B':
+			m.add("P")
+			current += m.skipDouble(current+1, 'B')
+		case 'C':
+			current += m.encodeC(current)
+		case 'D':
+			switch {
+			case m.stringAt(current, "DG") && m.stringAt(current+2, "I", "E", "Y"):
+				// E.g. "edge".
+				m.add("J")
+				current += 3
+			case m.stringAt(current, "DG"):
+				// E.g. "Edgar".
+				m.add("TK")
+				current += 2
+			case m.stringAt(current, "DT", "DD"):
+				m.add("T")
+				current += 2
+			default:
+				m.add("T")
+				current += 1
+			}
+		case 'F':
+			m.add("F")
+			current += m.skipDouble(current+1, 'F')
+		case 'G':
+			current += m.encodeG(current)
+		case 'H':
+			// Only kept if first or between vowels.
+
+			if (current == 0 || m.isVowel(current-1)) && m.isVowel(current+1) {
+				m.add("H")
+				current += 2
+			} else {
+				current += 1
+			}
+		case 'J':
+			current += m.encodeJ(current)
+		case 'K':
+			m.add("K")
+			current += m.skipDouble(current+1, 'K')
+		case 'L':
+			current += m.encodeL(current)
+		case 'M':
+			m.add("M")
+
+			if (m.stringAt(current-1, "UMB") && (current+1 == m.last || m.stringAt(current+2, "ER"))) || m.at(current+1) == 'M' {
+				current += 2
+			} else {
+				current += 1
+			}
+		case 'N':
+			m.add("N")
+			current += m.skipDouble(current+1, 'N')
+		case 'P':
+			switch {
+			case m.at(current+1) == 'H':
+				m.add("F")
+				current += 2
+			case m.stringAt(current+1, "P", "B"):
+				// Also "Campbell" and "raspberry".
+				m.add("P")
+				current += 2
+			default:
+				m.add("P")
+				current += 1
+			}
+		case 'Q':
+			m.add("K")
+			current += m.skipDouble(current+1, 'Q')
+		case 'R':
+			// French, e.g. "Rogier", but not "Hochmeier".
+
+			if current == m.last && !m.isSlavoGermanic() && m.stringAt(current-2, "IE") && !m.stringAt(current-4, "ME", "MA") {
+				m.addBoth("", "R")
+			} else {
+				m.add("R")
+			}
+
+			current += m.skipDouble(current+1, 'R')
+		case 'S':
+			current += m.encodeS(current)
+		case 'T':
+			current += m.encodeT(current)
+		case 'V':
+			m.add("F")
+			current += m.skipDouble(current+1, 'V')
+		case 'W':
+			current += m.encodeW(current)
+		case 'X':
+			// French, e.g. "breaux".
+
+			if !(current == m.last && (m.stringAt(current-3, "IAU", "EAU") || m.stringAt(current-2, "AU", "OU"))) {
+				m.add("KS")
+			}
+
+			if m.stringAt(current+1, "C", "X") {
+				current += 2
+			} else {
+				current += 1
+			}
+		case 'Z':
+			switch {
+			case m.at(current+1) == 'H':
+				// Chinese Pinyin, e.g. "Zhao".
+				m.add("J")
+				current += 2
+				continue
+			case m.stringAt(current+1, "ZO", "ZI", "ZA") || (m.isSlavoGermanic() && current > 0 && m.at(current-1) != 'T'):
+				m.addBoth("S", "TS")
+			default:
+				m.add("S")
+			}
+
+			current += m.skipDouble(current+1, 'Z')
+		default:
+			current += 1
+		}
+	}
+}
+
+// Encode the C at index current. Returns the number of runes consumed.
+func (m *metaphone) encodeC(current int) int {
+	// Various Germanic.
+
+	if current > 1 && !m.isVowel(current-2) && m.stringAt(current-1, "ACH") &&
+		m.at(current+2) != 'I' && (m.at(current+2) != 'E' || m.stringAt(current-2, "BACHER", "MACHER")) {
+		m.add("K")
+		return 2
+	}
+
+	// Special case "Caesar".
+
+	if current == 0 && m.stringAt(current, "CAESAR") {
+		m.add("S")
+		return 2
+	}
+
+	// Italian "Chianti".
+
+	if m.stringAt(current, "CHIA") {
+		m.add("K")
+		return 2
+	}
+
+	if m.stringAt(current, "CH") {
+		// "Michael".
+
+		if current > 0 && m.stringAt(current, "CHAE") {
+			m.addBoth("K", "X")
+			return 2
+		}
+
+		// Greek roots, e.g. "chemistry" or "chorus".
+
+		if current == 0 && (m.stringAt(current+1, "HARAC", "HARIS") || m.stringAt(current+1, "HOR", "HYM", "HIA", "HEM")) && !m.stringAt(0, "CHORE") {
+			m.add("K")
+			return 2
+		}
+
+		// Germanic, Greek or otherwise CH for the KH sound.
+
+		if m.stringAt(0, "VAN ", "VON ", "SCH") ||
+			m.stringAt(current-2, "ORCHES", "ARCHIT", "ORCHID") ||
+			m.stringAt(current+2, "T", "S") ||
+			((m.stringAt(current-1, "A", "O", "U", "E") || current == 0) && m.stringAt(current+2, "L", "R", "N", "M", "B", "H", "F", "V", "W", " ")) {
+			m.add("K")
+		} else if current > 0 {
+			if m.stringAt(0, "MC") {
+				m.add("K")
+			} else {
+				m.addBoth("X", "K")
+			}
+		} else {
+			m.add("X")
+		}
+
+		return 2
+	}
+
+	// E.g. "Czerny".
+
+	if m.stringAt(current, "CZ") && !m.stringAt(current-2, "WICZ") {
+		m.addBoth("S", "X")
+		return 2
+	}
+
+	// E.g. "focaccia".
+
+	if m.stringAt(current+1, "CIA") {
+		m.add("X")
+		return 3
+	}
+
+	// Double C, but not in "McClellan".
+
+	if m.stringAt(current, "CC") && !(current == 1 && m.at(0) == 'M') {
+		// "Bellocchio" but not "Bacchus".
+
+		if m.stringAt(current+2, "I", "E", "H") && !m.stringAt(current+2, "HU") {
+			if (current == 1 && m.at(current-1) == 'A') || m.stringAt(current-1, "UCCEE", "UCCES") {
+				// "accident", "accede" and "succeed".
+				m.add("KS")
+			} else {
+				// "bacci", "Bertucci" and other Italian.
+				m.add("X")
+			}
+
+			return 3
+		}
+
+		// Pierce's rule.
+
+		m.add("K")
+		return 2
+	}
+
+	if m.stringAt(current, "CK", "CG", "CQ") {
+		m.add("K")
+		return 2
+	}
+
+	if m.stringAt(current, "CI", "CE", "CY") {
+		// Italian or English.
+
+		if m.stringAt(current, "CIO", "CIE", "CIA") {
+			m.addBoth("S", "X")
+		} else {
+			m.add("S")
+		}
+
+		return 2
+	}
+
+	m.add("K")
+
+	// Names like "Mac Caffrey" or "Mac Gregor".
+
+	switch {
+	case m.stringAt(current+1, " C", " Q", " G"):
+		return 3
+	case m.stringAt(current+1, "C", "K", "Q") && !m.stringAt(current+1, "CE", "CI"):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Encode the G at index current. Returns the number of runes consumed.
+func (m *metaphone) encodeG(current int) int {
+	if m.at(current+1) == 'H' {
+		if current > 0 && !m.isVowel(current-1) {
+			m.add("K")
+			return 2
+		}
+
+		// "Ghislane" or "Ghiradelli".
+
+		if current == 0 {
+			if m.at(current+2) == 'I' {
+				m.add("J")
+			} else {
+				m.add("K")
+			}
+
+			return 2
+		}
+
+		// Parker's rule, e.g. "Hugh", "bough" or "Broughton".
+
+		if (current > 1 && m.stringAt(current-2, "B", "H", "D")) ||
+			(current > 2 && m.stringAt(current-3, "B", "H", "D")) ||
+			(current > 3 && m.stringAt(current-4, "B", "H")) {
+			return 2
+		}
+
+		// E.g. "laugh", "McLaughlin", "cough", "rough" or "tough".
+
+		if current > 2 && m.at(current-1) == 'U' && m.stringAt(current-3, "C", "G", "L", "R", "T") {
+			m.add("F")
+		} else if current > 0 && m.at(current-1) != 'I' {
+			m.add("K")
+		}
+
+		return 2
+	}
+
+	if m.at(current+1) == 'N' {
+		if current == 1 && m.isVowel(0) && !m.isSlavoGermanic() {
+			m.addBoth("KN", "N")
+		} else if !m.stringAt(current+2, "EY") && m.at(current+1) != 'Y' && !m.isSlavoGermanic() {
+			// Not e.g. "Cagney".
+			m.addBoth("N", "KN")
+		} else {
+			m.add("KN")
+		}
+
+		return 2
+	}
+
+	// "Tagliaro".
+
+	if m.stringAt(current+1, "LI") && !m.isSlavoGermanic() {
+		m.addBoth("KL", "L")
+		return 2
+	}
+
+	// -ges-, -gep-, -gel- and -gie- at the start.
+
+	if current == 0 && (m.at(current+1) == 'Y' || m.stringAt(current+1, "ES", "EP", "EB", "EL", "EY", "IB", "IL", "IN", "IE", "EI", "ER")) {
+		m.addBoth("K", "J")
+		return 2
+	}
+
+	// -ger- and -gy-.
+
+	if (m.stringAt(current+1, "ER") || m.at(current+1) == 'Y') &&
+		!m.stringAt(0, "DANGER", "RANGER", "MANGER") &&
+		!m.stringAt(current-1, "E", "I") &&
+		!m.stringAt(current-1, "RGY", "OGY") {
+		m.addBoth("K", "J")
+		return 2
+	}
+
+	// Italian, e.g. "Biaggi".
+
+	if m.stringAt(current+1, "E", "I", "Y") || m.stringAt(current-1, "AGGI", "OGGI") {
+		if m.stringAt(0, "VAN ", "VON ", "SCH") || m.stringAt(current+1, "ET") {
+			// Obviously Germanic.
+			m.add("K")
+		} else if m.stringAt(current+1, "IER ") {
+			// Always soft with a French ending.
+			m.add("J")
+		} else {
+			m.addBoth("J", "K")
+		}
+
+		return 2
+	}
+
+	m.add("K")
+	return m.skipDouble(current+1, 'G')
+}
+
+// Encode the J at index current. Returns the number of runes consumed.
+func (m *metaphone) encodeJ(current int) int {
+	// Obviously Spanish, e.g. "Jose" or "San Jacinto".
+
+	if m.stringAt(current, "JOSE") || m.stringAt(0, "SAN ") {
+		if (current == 0 && m.at(current+4) == ' ') || m.stringAt(0, "SAN ") {
+			m.add("H")
+		} else {
+			m.addBoth("J", "H")
+		}
+
+		return 1
+	}
+
+	switch {
+	case current == 0:
+		// "Yankelovich" or "Jankelowicz".
+		m.addBoth("J", "A")
+	case m.isVowel(current-1) && !m.isSlavoGermanic() && (m.at(current+1) == 'A' || m.at(current+1) == 'O'):
+		// Spanish, e.g. "bajador".
+		m.addBoth("J", "H")
+	case current == m.last:
+		m.addBoth("J", "")
+	case !m.stringAt(current+1, "L", "T", "K", "S", "N", "M", "B", "Z") && !m.stringAt(current-1, "S", "K", "L"):
+		m.add("J")
+	}
+
+	return m.skipDouble(current+1, 'J')
+}
+
+// Encode the L at index current. Returns the number of runes consumed.
+func (m *metaphone) encodeL(current int) int {
+	if m.at(current+1) != 'L' {
+		m.add("L")
+		return 1
+	}
+
+	// Spanish, e.g. "Cabrillo" or "Gallegos".
+
+	if (current == m.length-3 && m.stringAt(current-1, "ILLO", "ILLA", "ALLE")) ||
+		((m.stringAt(m.last-1, "AS", "OS") || m.stringAt(m.last, "A", "O")) && m.stringAt(current-1, "ALLE")) {
+		m.addBoth("L", "")
+		return 2
+	}
+
+	m.add("L")
+	return 2
+}
+
+// Encode the S at index current. Returns the number of runes consumed.
+func (m *metaphone) encodeS(current int) int {
+	// "Island", "isle", "Carlisle" and "Carlysle".
+
+	if m.stringAt(current-1, "ISL", "YSL") {
+		return 1
+	}
+
+	// "Sugar".
+
+	if current == 0 && m.stringAt(current, "SUGAR") {
+		m.addBoth("X", "S")
+		return 1
+	}
+
+	if m.stringAt(current, "SH") {
+		if m.stringAt(current+1, "HEIM", "HOEK", "HOLM", "HOLZ") {
+			// Germanic.
+			m.add("S")
+		} else {
+			m.add("X")
+		}
+
+		return 2
+	}
+
+	// Italian and Armenian.
+
+	if m.stringAt(current, "SIO", "SIA") || m.stringAt(current, "SIAN") {
+		if !m.isSlavoGermanic() {
+			m.addBoth("S", "X")
+		} else {
+			m.add("S")
+		}
+
+		return 3
+	}
+
+	// German and anglicisations, e.g. "Smith" matching "Schmidt" or
+	// "Snider" matching "Schneider". Also -sz- in Slavic languages.
+
+	if (current == 0 && m.stringAt(current+1, "M", "N", "L", "W")) || m.stringAt(current+1, "Z") {
+		m.addBoth("S", "X")
+		return m.skipDouble(current+1, 'Z')
+	}
+
+	if m.stringAt(current, "SC") {
+		// Schlesinger's rule.
+
+		if m.at(current+2) == 'H' {
+			// Dutch, e.g. "school" or "schooner".
+
+			if m.stringAt(current+3, "OO", "ER", "EN", "UY", "ED", "EM") {
+				if m.stringAt(current+3, "ER", "EN") {
+					// "Schermerhorn" or "Schenker".
+					m.addBoth("X", "SK")
+				} else {
+					m.add("SK")
+				}
+
+				return 3
+			}
+
+			if current == 0 && !m.isVowel(3) && m.at(3) != 'W' {
+				m.addBoth("X", "S")
+			} else {
+				m.add("X")
+			}
+
+			return 3
+		}
+
+		if m.stringAt(current+2, "I", "E", "Y") {
+			m.add("S")
+			return 3
+		}
+
+		m.add("SK")
+		return 3
+	}
+
+	// French, e.g. "Resnais" or "Artois".
+
+	if current == m.last && m.stringAt(current-2, "AI", "OI") {
+		m.addBoth("", "S")
+	} else {
+		m.add("S")
+	}
+
+	if m.stringAt(current+1, "S", "Z") {
+		return 2
+	}
+
+	return 1
+}
+
+// Encode the T at index current. Returns the number of runes consumed.
+func (m *metaphone) encodeT(current int) int {
+	if m.stringAt(current, "TION") {
+		m.add("X")
+		return 3
+	}
+
+	if m.stringAt(current, "TIA", "TCH") {
+		m.add("X")
+		return 3
+	}
+
+	if m.stringAt(current, "TH") || m.stringAt(current, "TTH") {
+		// "Thomas", "Thames" or Germanic.
+
+		if m.stringAt(current+2, "OM", "AM") || m.stringAt(0, "VAN ", "VON ", "SCH") {
+			m.add("T")
+		} else {
+			m.addBoth("0", "T")
+		}
+
+		return 2
+	}
+
+	m.add("T")
+
+	if m.stringAt(current+1, "T", "D") {
+		return 2
+	}
+
+	return 1
+}
+
+// Encode the W at index current. Returns the number of runes consumed.
+func (m *metaphone) encodeW(current int) int {
+	if m.stringAt(current, "WR") {
+		m.add("R")
+		return 2
+	}
+
+	// "Wasserman" should match "Vasserman" and "Uomo" should match "Womo".
+
+	if current == 0 && (m.isVowel(current+1) || m.stringAt(current, "WH")) {
+		if m.isVowel(current + 1) {
+			m.addBoth("A", "F")
+		} else {
+			m.add("A")
+		}
+	}
+
+	// "Arnow" should match "Arnoff".
+
+	if (current == m.last && m.isVowel(current-1)) || m.stringAt(current-1, "EWSKI", "EWSKY", "OWSKI", "OWSKY") || m.stringAt(0, "SCH") {
+		m.addBoth("", "F")
+		return 1
+	}
+
+	// Polish, e.g. "Filipowicz".
+
+	if m.stringAt(current, "WICZ", "WITZ") {
+		m.addBoth("TS", "FX")
+		return 4
+	}
+
+	return 1
+}
@@ -0,0 +1,26 @@
+package wikidictools
+
+import "testing"
+
+func TestDoubleMetaphone(t *testing.T) {
+	tests := []struct {
+		word      string
+		primary   string
+		alternate string
+	}{
+		{"Smith", "SM0", "XMT"},
+		{"Schmidt", "XMT", "SMT"},
+		{"Tymczak", "TMSK", "TMXK"},
+		{"Ashcraft", "AXKR", "AXKR"},
+		{"Thomas", "TMS", "TMS"},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		primary, alternate := DoubleMetaphone(test.word)
+
+		if primary != test.primary || alternate != test.alternate {
+			t.Errorf("got %q, %q for %q, expected %q, %q", primary, alternate, test.word, test.primary, test.alternate)
+		}
+	}
+}
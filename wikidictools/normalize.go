@@ -0,0 +1,64 @@
+package wikidictools
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Replaces the typographic variants of apostrophes and dashes found in
+// page titles with their ASCII counterparts.
+var punctuationReplacer = strings.NewReplacer(
+	"’", "'", // right single quotation mark
+	"‘", "'", // left single quotation mark
+	"ʼ", "'", // modifier letter apostrophe
+	"′", "'", // prime
+	"＇", "'", // fullwidth apostrophe
+	"‐", "-", // hyphen
+	"‑", "-", // non-breaking hyphen
+	"‒", "-", // figure dash
+	"–", "-", // en dash
+	"—", "-", // em dash
+	"−", "-", // minus sign
+	"﹣", "-", // small hyphen-minus
+	"－", "-", // fullwidth hyphen-minus
+)
+
+// Return the key under which word is looked up: in Unicode normal form
+// NFC, case-folded and with typographic apostrophes and dashes replaced by
+// "'" and "-", e.g. "don't" for "Don’t". If stripDiacritics is set,
+// diacritics are removed as well, e.g. "cafe" for "Café". Words with the
+// same key are spelled the same for most purposes.
+func NormalizeWord(word string, stripDiacritics bool) string {
+	word = punctuationReplacer.Replace(norm.NFC.String(word))
+
+	if stripDiacritics {
+		var stripped strings.Builder
+
+		// Decomposing splits letters with diacritics into the base
+		// letter and combining marks.
+
+		for _, r := range norm.NFD.String(word) {
+			if !unicode.Is(unicode.Mn, r) {
+				stripped.WriteRune(r)
+			}
+		}
+
+		word = stripped.String()
+	}
+
+	// Case folding may decompose characters again, e.g. for "ǰ".
+
+	return norm.NFC.String(cases.Fold().String(word))
+}
+
+// Return word case-folded and without diacritics, e.g. "cafe" for "Café"
+// and "strasse" for "Straße". Words that only differ in case and
+// diacritics have the same folded form. Unlike SortedLetters, characters
+// other than letters are kept. This is NormalizeWord with diacritics
+// stripped.
+func FoldWord(word string) string {
+	return NormalizeWord(word, true)
+}
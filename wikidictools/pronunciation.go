@@ -0,0 +1,83 @@
+package wikidictools
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Replacements for IPA symbols that transcriptions use interchangeably.
+var ipaKeyReplacer = strings.NewReplacer(
+	"ɡ", "g",
+	"ɹ", "r",
+	"ɫ", "l",
+	"ɚ", "ər",
+	"ɝ", "ɜr",
+	"ʧ", "tʃ",
+	"ʤ", "dʒ",
+)
+
+// Return all IPA transcriptions given on a single line of a "Pronunciation"
+// section, e.g. "* {{a|GA}} {{IPA|en|/dɔɡ/|/dɑɡ/}}".
+func parsePronunciations(line string) (transcriptions []string) {
+	if listIndentLevel(line) == 0 {
+		return nil
+	}
+
+	for _, t := range findTemplates(line) {
+		if t.name != "IPA" || len(t.positional) == 0 {
+			continue
+		}
+
+		// After the language come the transcriptions.
+
+		for _, transcription := range t.positional[1:] {
+			if transcription != "" {
+				transcriptions = append(transcriptions, transcription)
+			}
+		}
+	}
+
+	return transcriptions
+}
+
+// Return a key for comparing IPA transcriptions that ignores details of
+// the transcription, e.g. "dɒg" for both "/dɒɡ/" and "[ˈdɒːɡ]". Words with
+// the same key sound alike. Only the symbols for sounds are kept; slashes,
+// brackets, stress and length marks, syllable breaks and diacritics are
+// dropped. Some symbols used interchangeably are unified.
+func IpaKey(transcription string) string {
+	var key strings.Builder
+
+	// Most diacritics are combining marks. Stress, length and others are
+	// modifier letters.
+
+	for _, r := range norm.NFD.String(ipaKeyReplacer.Replace(transcription)) {
+		if unicode.IsLetter(r) && !unicode.Is(unicode.Lm, r) {
+			key.WriteRune(r)
+		}
+	}
+
+	return key.String()
+}
+
+// Append those values to slice that are not yet part of it.
+func appendUnique(slice []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+
+		for _, existing := range slice {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			slice = append(slice, value)
+		}
+	}
+
+	return slice
+}
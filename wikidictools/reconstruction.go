@@ -0,0 +1,47 @@
+package wikidictools
+
+import "strings"
+
+// Name of the namespace that holds reconstructed words of proto-languages.
+const RECONSTRUCTION_NAMESPACE_NAME = "Reconstruction"
+
+// Given a title like "Reconstruction:Proto-Indo-European/wódr̥", return the
+// proto-language and the reconstructed form. Returns false if title does not
+// follow that pattern.
+func parseReconstructionTitle(title string) (language string, form string, ok bool) {
+	_, path, ok := strings.Cut(title, ":")
+	if !ok {
+		return "", "", false
+	}
+
+	language, form, ok = strings.Cut(path, "/")
+	if !ok || language == "" || form == "" {
+		return "", "", false
+	}
+
+	return language, strings.TrimPrefix(form, "*"), true
+}
+
+// Parse a single line of a "Descendants" section, e.g.
+// "** {{desc|ang|wæter}}". Returns false if the line names no descendant,
+// e.g. because it only groups other descendants by language family.
+func parseDescendant(line string) (Descendant, bool) {
+	depth := listIndentLevel(line)
+	if depth == 0 {
+		return Descendant{}, false
+	}
+
+	t, ok := findTemplate(line, "desc", "desctree", "l")
+	if !ok || t.arg(0) == "" || t.arg(1) == "" || t.arg(1) == "-" {
+		return Descendant{}, false
+	}
+
+	descendant := Descendant{
+		Depth:    depth,
+		Language: t.arg(0),
+		Word:     t.arg(1),
+		Tree:     t.name == "desctree",
+	}
+
+	return descendant, true
+}
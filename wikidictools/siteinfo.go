@@ -0,0 +1,38 @@
+package wikidictools
+
+import "strings"
+
+// Name used to refer to the main namespace, which has no name in the
+// <siteinfo> of a dump.
+const MAIN_NAMESPACE_NAME = "Main"
+
+// Return the namespace with the given name, compared case-insensitively.
+// The main namespace can be looked up as MAIN_NAMESPACE_NAME. Returns false
+// if no such namespace exists.
+func (si *SiteInfo) NamespaceByName(name string) (Namespace, bool) {
+	name = strings.TrimSpace(name)
+
+	if strings.EqualFold(name, MAIN_NAMESPACE_NAME) {
+		name = ""
+	}
+
+	for _, namespace := range si.Namespaces {
+		if strings.EqualFold(namespace.Name, name) {
+			return namespace, true
+		}
+	}
+
+	return Namespace{}, false
+}
+
+// Return the namespace with the given ID. Returns false if no such
+// namespace exists.
+func (si *SiteInfo) NamespaceByKey(key int) (Namespace, bool) {
+	for _, namespace := range si.Namespaces {
+		if namespace.Key == key {
+			return namespace, true
+		}
+	}
+
+	return Namespace{}, false
+}
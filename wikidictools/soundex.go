@@ -0,0 +1,60 @@
+package wikidictools
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Soundex digit for each letter of the English alphabet. Vowels and the
+// letters H, W and Y have no digit.
+const _SOUNDEX_DIGITS = "01230120022455012623010202"
+
+// Return the American Soundex code of word, e.g. "R163" for "Robert". Only
+// the letters A to Z are considered; everything else is skipped. Returns the
+// empty string if word contains no such letters.
+func Soundex(word string) string {
+	var code strings.Builder
+
+	var last byte
+
+	for _, r := range word {
+		r = unicode.ToUpper(r)
+
+		if r < 'A' || r > 'Z' {
+			continue
+		}
+
+		digit := _SOUNDEX_DIGITS[r-'A']
+
+		if code.Len() == 0 {
+			code.WriteRune(r)
+			last = digit
+			continue
+		}
+
+		switch {
+		case r == 'H' || r == 'W':
+			// H and W do not separate letters with the same digit.
+		case digit == '0':
+			// Vowels do separate them.
+			last = digit
+		case digit != last:
+			code.WriteByte(digit)
+			last = digit
+		}
+
+		if code.Len() == 4 {
+			break
+		}
+	}
+
+	if code.Len() == 0 {
+		return ""
+	}
+
+	for code.Len() < 4 {
+		code.WriteByte('0')
+	}
+
+	return code.String()
+}
@@ -0,0 +1,27 @@
+package wikidictools
+
+import "testing"
+
+func TestSoundex(t *testing.T) {
+	tests := []struct {
+		word     string
+		expected string
+	}{
+		{"Robert", "R163"},
+		{"Rupert", "R163"},
+		{"Smith", "S530"},
+		{"Schmidt", "S530"},
+		{"Tymczak", "T522"},
+		{"Ashcraft", "A261"},
+		{"Pfister", "P236"},
+		{"Honeyman", "H555"},
+		{"Lee", "L000"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := Soundex(test.word); got != test.expected {
+			t.Errorf("got %q for %q, expected %q", got, test.word, test.expected)
+		}
+	}
+}
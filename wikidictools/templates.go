@@ -0,0 +1,132 @@
+package wikidictools
+
+import "strings"
+
+// A single use of a MediaWiki template like {{desc|en|water|bor=1}}.
+type template struct {
+	// Name of the template, e.g. "desc".
+	name string
+
+	// Arguments without a key, in order, e.g. ["en", "water"].
+	positional []string
+
+	// Arguments with a key, e.g. {"bor": "1"}.
+	named map[string]string
+}
+
+// Return the positional argument at index i or the empty string if there
+// is no such argument.
+func (t *template) arg(i int) string {
+	if i < len(t.positional) {
+		return t.positional[i]
+	}
+
+	return ""
+}
+
+// Return all top level templates used in line, in order. Templates nested
+// inside other templates are not returned on their own; they stay part of
+// the arguments of the outer template.
+func findTemplates(line string) (templates []template) {
+	for {
+		start := strings.Index(line, "{{")
+		if start == -1 {
+			return templates
+		}
+
+		end := matchingBracesEnd(line, start)
+		if end == -1 {
+			return templates
+		}
+
+		templates = append(templates, parseTemplate(line[start+2:end-2]))
+		line = line[end:]
+	}
+}
+
+// Return the first top level template in line with one of the given names
+// or false if there is none.
+func findTemplate(line string, names ...string) (template, bool) {
+	for _, t := range findTemplates(line) {
+		for _, name := range names {
+			if t.name == name {
+				return t, true
+			}
+		}
+	}
+
+	return template{}, false
+}
+
+// Given that line[start:] begins with "{{", return the index just after
+// the matching "}}" or -1 if the braces are unbalanced.
+func matchingBracesEnd(line string, start int) int {
+	depth := 0
+
+	for i := start; i < len(line)-1; i++ {
+		switch line[i : i+2] {
+		case "{{":
+			depth += 1
+			i += 1
+		case "}}":
+			depth -= 1
+			i += 1
+
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return -1
+}
+
+// Parse the contents of a template, that is everything between the
+// outermost "{{" and "}}".
+func parseTemplate(contents string) template {
+	parts := splitTemplateArguments(contents)
+
+	parsed := template{
+		name:  strings.TrimSpace(parts[0]),
+		named: make(map[string]string),
+	}
+
+	for _, part := range parts[1:] {
+		if key, value, ok := strings.Cut(part, "="); ok && isTemplateKey(key) {
+			parsed.named[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		} else {
+			parsed.positional = append(parsed.positional, strings.TrimSpace(part))
+		}
+	}
+
+	return parsed
+}
+
+// Split contents at each '|' that is not part of a nested template or link.
+func splitTemplateArguments(contents string) (parts []string) {
+	depth := 0
+	last := 0
+
+	for i := 0; i < len(contents); i++ {
+		switch {
+		case strings.HasPrefix(contents[i:], "{{") || strings.HasPrefix(contents[i:], "[["):
+			depth += 1
+			i += 1
+		case strings.HasPrefix(contents[i:], "}}") || strings.HasPrefix(contents[i:], "]]"):
+			depth -= 1
+			i += 1
+		case contents[i] == '|' && depth == 0:
+			parts = append(parts, contents[last:i])
+			last = i + 1
+		}
+	}
+
+	return append(parts, contents[last:])
+}
+
+// Return whether s looks like the key of a named template argument.
+// Keys are short and never contain whitespace inside them.
+func isTemplateKey(s string) bool {
+	s = strings.TrimSpace(s)
+	return len(s) > 0 && !strings.ContainsAny(s, " []{}")
+}
@@ -0,0 +1,94 @@
+package wikidictools
+
+import (
+	"bufio"
+	"strings"
+)
+
+// Name of the namespace that holds curated lists of related words.
+const THESAURUS_NAMESPACE_NAME = "Thesaurus"
+
+// Parse the text of a Thesaurus page. Only the English section is
+// considered.
+//
+// Thesaurus pages are structured by headings. Level 3 headings name the part
+// of speech, "Sense: x" headings introduce a sense and all other headings
+// name a relation like "Synonyms". Related words are listed with {{ws}}.
+func parseThesaurus(title string, text string) *Thesaurus {
+	_, headword, _ := strings.Cut(title, ":")
+
+	thesaurus := Thesaurus{
+		Headword: headword,
+	}
+
+	var (
+		inEnglishSection bool
+		current          SynonymSet
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if isLanguageHeading(line) {
+			inEnglishSection = getLowerHeadingFrom(line) == "english"
+			current = SynonymSet{}
+			continue
+		}
+
+		if !inEnglishSection {
+			continue
+		}
+
+		if isHeading(line) {
+			heading := getLowerHeadingFrom(line)
+
+			switch {
+			case headingLevel(line) == 3:
+				current = SynonymSet{PartOfSpeech: heading}
+			case strings.HasPrefix(heading, "sense:"):
+				current.Sense = strings.TrimSpace(strings.TrimPrefix(heading, "sense:"))
+				current.Gloss = ""
+				current.Relation = ""
+			default:
+				current.Relation = heading
+			}
+
+			continue
+		}
+
+		if t, ok := findTemplate(line, "ws sense"); ok {
+			current.Gloss = t.arg(1)
+			continue
+		}
+
+		if current.Relation == "" {
+			continue
+		}
+
+		if t, ok := findTemplate(line, "ws", "l"); ok && t.arg(1) != "" {
+			thesaurus.addWord(&current, t.arg(1))
+		}
+	}
+
+	return &thesaurus
+}
+
+// Add word to the set described by current. If the last set of the thesaurus
+// is that set, the word is appended to it. Otherwise a new set is started.
+func (th *Thesaurus) addWord(current *SynonymSet, word string) {
+	if n := len(th.Sets); n > 0 {
+		last := &th.Sets[n-1]
+
+		if last.PartOfSpeech == current.PartOfSpeech && last.Sense == current.Sense && last.Relation == current.Relation {
+			last.Words = append(last.Words, word)
+			return
+		}
+	}
+
+	set := *current
+	set.Words = []string{word}
+
+	th.Sets = append(th.Sets, set)
+}
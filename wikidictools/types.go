@@ -11,34 +11,198 @@ type XmlParser interface {
 	// failure case.
 	Next() (*DictionaryEntry, error)
 
+	// Return information about the wiki the dump was exported from.
+	SiteInfo() SiteInfo
+
 	io.Closer
 }
 
+// Options that control which parts of a dump an XmlParser extracts.
+type XmlParserOptions struct {
+	// Names of the namespaces to extract pages from as listed in the
+	// <siteinfo> of the dump, e.g. "Appendix". The main namespace, which
+	// holds regular dictionary entries, has the name "Main". If empty, only
+	// pages in the main namespace are extracted.
+	//
+	// Pages in the "Reconstruction" namespace describe words of a single
+	// proto-language. For those, definitions are extracted regardless of
+	// language.
+	Namespaces []string
+
+	// Whether DictionaryEntry.Key has diacritics removed. See
+	// NormalizeWord.
+	StripDiacritics bool
+}
+
+// Information about the wiki a dump was exported from as found in the
+// <siteinfo> header of the dump.
+type SiteInfo struct {
+	// Name of the wiki, e.g. "Wiktionary".
+	SiteName string `xml:"sitename"`
+
+	// Name of the database the dump was exported from, e.g. "enwiktionary".
+	DbName string `xml:"dbname"`
+
+	// URL of the main page of the wiki.
+	Base string `xml:"base"`
+
+	// Software and version that generated the dump.
+	Generator string `xml:"generator"`
+
+	// All namespaces of the wiki.
+	Namespaces []Namespace `xml:"namespaces>namespace"`
+}
+
+// A namespace of the wiki. Each page is part of exactly one namespace.
+type Namespace struct {
+	// Numeric ID of the namespace, as used by pages in the dump.
+	Key int `xml:"key,attr"`
+
+	// Either "first-letter" or "case-sensitive".
+	Case string `xml:"case,attr"`
+
+	// Name of the namespace, e.g. "Appendix". The name of the main namespace
+	// is empty.
+	Name string `xml:",chardata"`
+}
+
 // A single entry of the dictionary.
 type DictionaryEntry struct {
 	// Word this entry is about.
-	Word string
+	Word string `json:"word"`
+
+	// Normalized form of the headword to look it up by, e.g. "don't" for
+	// "Don’t". See Headword, NormalizeWord and
+	// XmlParserOptions.StripDiacritics.
+	Key string `json:"key"`
 
 	// Revision of this particular Wiktionary page.
-	Revision uint64
+	Revision uint64 `json:"revision"`
+
+	// ID of the namespace the page is part of. Pages in the main namespace
+	// have ID 0. See SiteInfo for the list of namespaces.
+	Namespace int `json:"namespace"`
+
+	// Time the revision was made, as given in the dump. Usually an RFC 3339
+	// timestamp.
+	Timestamp string `json:"timestamp,omitempty"`
+
+	// Other spellings of the word as listed in the "Alternative forms"
+	// section. May be nil.
+	AlternativeForms []string `json:"alternativeForms,omitempty"`
+
+	// Inflected forms of the word derived from English headword templates
+	// like {{en-noun}} or {{en-verb}}, e.g. "dogs" and "dogged". May be nil.
+	Inflections []string `json:"inflections,omitempty"`
+
+	// IPA transcriptions from the "Pronunciation" section including their
+	// slashes or brackets, e.g. "/dɒɡ/". May be nil.
+	Pronunciations []string `json:"pronunciations,omitempty"`
+
+	// Plain text of each "Etymology" section. Words with more than one
+	// etymology have numbered sections, e.g. "Etymology 1". May be nil.
+	Etymologies []string `json:"etymologies,omitempty"`
+
+	// Pages the definitions link to, e.g. "man" for "[[man|guy]]", in page
+	// order and once for each link. The definitions themselves only keep
+	// the text of their links. May be nil.
+	Links []string `json:"links,omitempty"`
+
+	// Labels given with {{lb}} that apply to every definition of the word,
+	// e.g. "offensive" or "rare". Labels of only some definitions are not
+	// listed. May be nil.
+	Labels []string `json:"labels,omitempty"`
+
+	// Whether all definitions come from "Proper noun" sections, e.g. for
+	// "Paris". Proper nouns are part of Noun.
+	ProperNoun bool `json:"properNoun,omitempty"`
 
 	// Noun defintions. Each entry in the slice contains one possible defintion.
 	// May be nil.
-	Noun []string
+	Noun []string `json:"noun,omitempty"`
 
 	// Noun defintions. Each entry in the slice contains one possible defintion.
 	// May be nil.
-	Verb []string
+	Verb []string `json:"verb,omitempty"`
 
 	// Adjective defintions. Each entry in the slice contains one possible
 	// defintion. May be nil.
-	Adjective []string
+	Adjective []string `json:"adjective,omitempty"`
 
 	// Adverb defintions. Each entry in the slice contains one possible
 	// defintion. May be nil.
-	Adverb []string
+	Adverb []string `json:"adverb,omitempty"`
 
 	// Phrase defintions. Each entry in the slice contains one possible
 	// defintion. May be nil.
-	Phrase []string
+	Phrase []string `json:"phrase,omitempty"`
+
+	// Set for pages in the Reconstruction namespace. Nil otherwise.
+	Reconstruction *Reconstruction `json:"reconstruction,omitempty"`
+
+	// Set for pages in the Thesaurus namespace. Nil otherwise.
+	Thesaurus *Thesaurus `json:"thesaurus,omitempty"`
+}
+
+// The contents of a page like "Thesaurus:dog".
+type Thesaurus struct {
+	// The word the page is about, e.g. "dog".
+	Headword string `json:"headword"`
+
+	// Groups of related words in the order they are listed on the page.
+	// May be nil.
+	Sets []SynonymSet `json:"sets,omitempty"`
+}
+
+// A group of words that share one relation to one sense of a headword
+// in the Thesaurus.
+type SynonymSet struct {
+	// Lower case part of speech, e.g. "noun".
+	PartOfSpeech string `json:"pos"`
+
+	// Short name of the sense, e.g. "mammal". May be empty.
+	Sense string `json:"sense,omitempty"`
+
+	// Longer description of the sense as given with {{ws sense}}. May be
+	// empty.
+	Gloss string `json:"gloss,omitempty"`
+
+	// Lower case relation of the words to the sense, e.g. "synonyms" or
+	// "hyponyms".
+	Relation string `json:"relation"`
+
+	// The related words.
+	Words []string `json:"words"`
+}
+
+// A reconstructed word of a proto-language as found on pages like
+// "Reconstruction:Proto-Indo-European/wódr̥".
+type Reconstruction struct {
+	// Name of the proto-language, e.g. "Proto-Indo-European".
+	Language string `json:"language"`
+
+	// The reconstructed form without the leading asterisk, e.g. "wódr̥".
+	Form string `json:"form"`
+
+	// Descendants of the reconstructed word in the order they are listed
+	// on the page. Together with their depth, they form a tree. May be nil.
+	Descendants []Descendant `json:"descendants,omitempty"`
+}
+
+// A word that descends from a reconstructed word.
+type Descendant struct {
+	// Nesting depth in the tree of descendants. Direct descendants of the
+	// reconstructed word have depth 1. A descendant with depth n+1 descends
+	// from the closest preceding descendant with depth n.
+	Depth int `json:"depth"`
+
+	// Wiktionary language code of the descendant, e.g. "gem-pro".
+	Language string `json:"language"`
+
+	// The descendant word itself, e.g. "*watōr".
+	Word string `json:"word"`
+
+	// Whether the descendant was listed with {{desctree}}. These have a page
+	// of their own that lists further descendants.
+	Tree bool `json:"tree,omitempty"`
 }
@@ -2,6 +2,7 @@ package wikidictools
 
 import (
 	"bufio"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"regexp"
@@ -25,26 +26,72 @@ var _META_PAREN_EQUALS = regexp.MustCompile(`(?m)\(\w+=\w+\)`)
 
 type xmlParser struct {
 	reader     io.ReadCloser
-	wikiParser wikiparse.Parser
+	decoder    *xml.Decoder
+	siteInfo   SiteInfo
+	namespaces map[int]bool
+
+	// Whether keys of entries have diacritics removed.
+	stripDiacritics bool
+
+	// IDs of special namespaces or -1 if the dump has none.
+	reconstructionNamespace int
+	thesaurusNamespace      int
 }
 
-// Create new XmlParser for the given stream.
+// Create new XmlParser for the given stream. Only English definitions
+// from pages in the main namespace are extracted.
 func NewXmlParser(rx io.ReadCloser) (XmlParser, error) {
-	wikiParser, err := wikiparse.NewParser(rx)
+	return NewXmlParserWithOptions(rx, XmlParserOptions{})
+}
+
+// Create new XmlParser for the given stream that extracts the parts
+// of the dump selected by options. Only English definitions are extracted.
+func NewXmlParserWithOptions(rx io.ReadCloser, options XmlParserOptions) (XmlParser, error) {
+	decoder := xml.NewDecoder(rx)
+
+	siteInfo, err := readSiteInfo(decoder)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not create underlying xml parser")
+		return nil, errors.Wrap(err, "could not read site info")
 	}
 
 	created := &xmlParser{
 		reader:     rx,
-		wikiParser: wikiParser,
+		decoder:    decoder,
+		siteInfo:   siteInfo,
+		namespaces: make(map[int]bool),
+
+		stripDiacritics: options.StripDiacritics,
+
+		reconstructionNamespace: -1,
+		thesaurusNamespace:      -1,
+	}
+
+	if namespace, ok := siteInfo.NamespaceByName(RECONSTRUCTION_NAMESPACE_NAME); ok {
+		created.reconstructionNamespace = namespace.Key
+	}
+
+	if namespace, ok := siteInfo.NamespaceByName(THESAURUS_NAMESPACE_NAME); ok {
+		created.thesaurusNamespace = namespace.Key
+	}
+
+	if len(options.Namespaces) == 0 {
+		created.namespaces[0] = true
+	}
+
+	for _, name := range options.Namespaces {
+		namespace, ok := siteInfo.NamespaceByName(name)
+		if !ok {
+			return nil, errors.Errorf("dump has no namespace named %q", name)
+		}
+
+		created.namespaces[namespace.Key] = true
 	}
 
 	return created, nil
 }
 
 func (xp *xmlParser) Next() (*DictionaryEntry, error) {
-	page, err := nextDictionaryPage(xp.wikiParser)
+	page, err := xp.nextDictionaryPage()
 
 	if err == io.EOF {
 		return nil, err
@@ -54,22 +101,44 @@ func (xp *xmlParser) Next() (*DictionaryEntry, error) {
 		return nil, errors.Wrap(err, "could not read from underlying parser")
 	}
 
-	return pageToDictEntry(page), nil
+	return xp.pageToDictEntry(page), nil
+}
+
+func (xp *xmlParser) SiteInfo() SiteInfo {
+	return xp.siteInfo
 }
 
 func (xp *xmlParser) Close() error {
 	return xp.reader.Close()
 }
 
-func nextDictionaryPage(parser wikiparse.Parser) (*wikiparse.Page, error) {
-	for {
-		page, err := parser.Next()
+// Read the <siteinfo> header at the start of a dump. Leaves the decoder
+// positioned at the first <page>.
+func readSiteInfo(decoder *xml.Decoder) (SiteInfo, error) {
+	var siteInfo SiteInfo
 
+	for {
+		token, err := decoder.Token()
 		if err != nil {
+			return siteInfo, err
+		}
+
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "siteinfo" {
+			err := decoder.DecodeElement(&siteInfo, &start)
+			return siteInfo, err
+		}
+	}
+}
+
+func (xp *xmlParser) nextDictionaryPage() (*wikiparse.Page, error) {
+	for {
+		var page wikiparse.Page
+
+		if err := xp.decoder.Decode(&page); err != nil {
 			return nil, err
 		}
 
-		if !isDictionaryEntry(page) {
+		if !xp.isDictionaryEntry(&page) {
 			continue
 		}
 
@@ -77,24 +146,49 @@ func nextDictionaryPage(parser wikiparse.Parser) (*wikiparse.Page, error) {
 			continue
 		}
 
-		return page, nil
+		return &page, nil
 	}
 }
 
-// Return whether the given page appears to be a page related to some specific
-// word. Filters out meta pages part of the Wiktionary wiki.
-func isDictionaryEntry(page *wikiparse.Page) bool {
-	return len(page.Title) > 0 && !strings.ContainsRune(page.Title, ':')
+// Return whether the given page is part of one of the selected namespaces.
+// Filters out meta pages part of the Wiktionary wiki.
+func (xp *xmlParser) isDictionaryEntry(page *wikiparse.Page) bool {
+	return len(page.Title) > 0 && xp.namespaces[int(page.Ns)]
 }
 
-func pageToDictEntry(page *wikiparse.Page) *DictionaryEntry {
+func (xp *xmlParser) pageToDictEntry(page *wikiparse.Page) *DictionaryEntry {
 	// We are going to fill up this entry line by line.
 
 	revision := page.Revisions[0]
 
 	entry := DictionaryEntry{
-		Word:     page.Title,
-		Revision: revision.ID,
+		Word:      page.Title,
+		Revision:  revision.ID,
+		Namespace: int(page.Ns),
+		Timestamp: revision.Timestamp,
+	}
+
+	// Thesaurus pages have a structure of their own and no definitions.
+
+	if entry.Namespace == xp.thesaurusNamespace {
+		entry.Thesaurus = parseThesaurus(page.Title, revision.Text)
+
+		return &entry
+	}
+
+	// Reconstructed words carry their proto-language and form in the title.
+	// Their pages only describe that one proto-language, so we accept any
+	// language section.
+
+	isReconstruction := entry.Namespace == xp.reconstructionNamespace
+
+	if isReconstruction {
+		if language, form, ok := parseReconstructionTitle(page.Title); ok {
+			entry.Reconstruction = &Reconstruction{
+				Language: language,
+				Form:     form,
+			}
+		}
 	}
 
 	// To parse each line, we build up a small DFA with states defined
@@ -108,12 +202,27 @@ func pageToDictEntry(page *wikiparse.Page) *DictionaryEntry {
 		adjective
 		adverb
 		phrase
+		descendants
+		alternativeForms
+		pronunciation
+		etymology
 		unknown
 	)
 
 	inEnglishSection := false
 	currentSubSection := unknown
 
+	// Labels are only of interest if they apply to every definition, so
+	// we just keep those that all definitions so far have in common.
+	// Similarly, we count definitions of proper nouns.
+
+	var (
+		commonLabels  []string
+		ndefinitions  int
+		nproperNouns  int
+		inProperNouns bool
+	)
+
 	payload := strings.NewReader(revision.Text)
 	scanner := bufio.NewScanner(payload)
 
@@ -122,16 +231,16 @@ func pageToDictEntry(page *wikiparse.Page) *DictionaryEntry {
 
 		// Check whether this line introduces a change in language/section.
 
-		if isHeading(line) && !inEnglishSection {
-			if getLowerHeadingFrom(line) == "english" {
-				inEnglishSection = true
-				currentSubSection = unknown
-			}
+		if isLanguageHeading(line) {
+			inEnglishSection = isReconstruction || getLowerHeadingFrom(line) == "english"
+			currentSubSection = unknown
+			inProperNouns = false
+			continue
 		}
 
-		// If we are not changing section but are currently not in the English
-		// section, just keep looping. We currently only support the English
-		// language.
+		// If we are currently not in the English section, just keep looping.
+		// We currently only support the English language and reconstructed
+		// words.
 
 		if !inEnglishSection {
 			continue
@@ -141,7 +250,20 @@ func pageToDictEntry(page *wikiparse.Page) *DictionaryEntry {
 		// that is supported by the DictionaryEntry type.
 
 		if isHeading(line) {
-			switch getLowerHeadingFrom(line) {
+			heading := getLowerHeadingFrom(line)
+
+			// Pages with more than one etymology number them and nest
+			// the other sections below.
+
+			if heading == "etymology" || strings.HasPrefix(heading, "etymology ") {
+				entry.Etymologies = append(entry.Etymologies, "")
+				currentSubSection = etymology
+				continue
+			}
+
+			inProperNouns = heading == "proper noun"
+
+			switch heading {
 			case "noun":
 				currentSubSection = noun
 			case "proper noun":
@@ -156,6 +278,12 @@ func pageToDictEntry(page *wikiparse.Page) *DictionaryEntry {
 				currentSubSection = adverb
 			case "phrase":
 				currentSubSection = phrase
+			case "descendants":
+				currentSubSection = descendants
+			case "alternative forms":
+				currentSubSection = alternativeForms
+			case "pronunciation":
+				currentSubSection = pronunciation
 			default:
 				currentSubSection = unknown
 			}
@@ -169,6 +297,52 @@ func pageToDictEntry(page *wikiparse.Page) *DictionaryEntry {
 			continue
 		}
 
+		// Descendants are nested lists and only of interest for reconstructed
+		// words.
+
+		if currentSubSection == descendants {
+			if entry.Reconstruction == nil {
+				continue
+			}
+
+			if descendant, ok := parseDescendant(line); ok {
+				entry.Reconstruction.Descendants = append(entry.Reconstruction.Descendants, descendant)
+			}
+
+			continue
+		}
+
+		if currentSubSection == alternativeForms {
+			entry.AlternativeForms = append(entry.AlternativeForms, parseAlternativeForms(line)...)
+			continue
+		}
+
+		if currentSubSection == pronunciation {
+			entry.Pronunciations = appendUnique(entry.Pronunciations, parsePronunciations(line)...)
+			continue
+		}
+
+		// Etymologies are running text. Lists in there are usually
+		// about something else.
+
+		if currentSubSection == etymology {
+			last := &entry.Etymologies[len(entry.Etymologies)-1]
+
+			if text := parseEtymology(line); text != "" && listIndentLevel(line) == 0 {
+				*last = strings.TrimSpace(*last + " " + text)
+			}
+
+			continue
+		}
+
+		// Headword lines come right before the definitions and name the
+		// inflected forms.
+
+		if listIndentLevel(line) == 0 {
+			entry.Inflections = appendUnique(entry.Inflections, parseInflections(entry.Word, line)...)
+			continue
+		}
+
 		// Now we just add elements for each supported section.
 
 		if isTopLevelListEntry(line) {
@@ -178,6 +352,20 @@ func pageToDictEntry(page *wikiparse.Page) *DictionaryEntry {
 				continue
 			}
 
+			entry.Links = append(entry.Links, GetLinkTargetsFrom(line)...)
+
+			if labels := parseLabels(line); ndefinitions == 0 {
+				commonLabels = labels
+			} else {
+				commonLabels = Intersect(commonLabels, labels)
+			}
+
+			ndefinitions += 1
+
+			if inProperNouns {
+				nproperNouns += 1
+			}
+
 			switch currentSubSection {
 			case noun:
 				entry.Noun = append(entry.Noun, listEntry)
@@ -193,6 +381,26 @@ func pageToDictEntry(page *wikiparse.Page) *DictionaryEntry {
 		}
 	}
 
+	entry.Key = NormalizeWord(entry.Headword(), xp.stripDiacritics)
+	entry.Labels = commonLabels
+	entry.ProperNoun = nproperNouns > 0 && nproperNouns == ndefinitions
+
+	// Some etymology sections only contain templates we drop.
+
+	etymologies := entry.Etymologies[:0]
+
+	for _, text := range entry.Etymologies {
+		if text != "" {
+			etymologies = append(etymologies, text)
+		}
+	}
+
+	if len(etymologies) > 0 {
+		entry.Etymologies = etymologies
+	} else {
+		entry.Etymologies = nil
+	}
+
 	return &entry
 }
 
@@ -200,8 +408,17 @@ func isHeading(line string) bool {
 	return strings.HasPrefix(line, "==") && strings.HasSuffix(line, "==")
 }
 
+func isLanguageHeading(line string) bool {
+	return isHeading(line) && headingLevel(line) == 2
+}
+
+// Return the level of heading line, that is the number of '=' it starts with.
+func headingLevel(line string) int {
+	return len(line) - len(strings.TrimLeft(line, "="))
+}
+
 func getLowerHeadingFrom(line string) string {
-	return strings.ToLower(strings.Trim(line, "="))
+	return strings.ToLower(strings.TrimSpace(strings.Trim(line, "=")))
 }
 
 func isTopLevelListEntry(line string) bool {
@@ -0,0 +1,107 @@
+package wikidictools
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A dump with a single page that has sections for more than one language.
+const multiLanguageDump = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/">
+  <siteinfo>
+    <sitename>Wiktionary</sitename>
+    <dbname>enwiktionary</dbname>
+    <namespaces>
+      <namespace key="0" case="case-sensitive" />
+    </namespaces>
+  </siteinfo>
+  <page>
+    <title>chat</title>
+    <ns>0</ns>
+    <id>1</id>
+    <revision>
+      <id>42</id>
+      <timestamp>2024-03-01T00:00:00Z</timestamp>
+      <text xml:space="preserve">==Afrikaans==
+
+===Noun===
+{{af-noun}}
+
+# A [[chat]] in Afrikaans.
+
+==English==
+
+===Etymology===
+Clipping of {{m|en|chatter}}.
+
+===Pronunciation===
+* {{IPA|en|/tʃæt/}}
+
+===Noun===
+{{en-noun}}
+
+# {{lb|en|informal}} An [[informal]] [[conversation]].
+
+===Verb===
+{{en-verb|chatt|ed}}
+
+# To talk in an [[informal]] [[manner|way]].
+
+==French==
+
+===Etymology===
+From {{inh|fr|fro|chat}}.
+
+===Pronunciation===
+* {{IPA|fr|/ʃa/}}
+
+===Noun===
+{{fr-noun|m}}
+
+# {{lb|fr|zoology}} A [[cat]].
+
+===Proper noun===
+{{fr-proper noun|m}}
+
+# A [[surname]].
+</text>
+    </revision>
+  </page>
+</mediawiki>`
+
+func TestXmlParserMultipleLanguages(t *testing.T) {
+	parser, err := NewXmlParser(ioutil.NopCloser(strings.NewReader(multiLanguageDump)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer parser.Close()
+
+	entry, err := parser.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := DictionaryEntry{
+		Word:           "chat",
+		Key:            "chat",
+		Revision:       42,
+		Timestamp:      "2024-03-01T00:00:00Z",
+		Noun:           []string{"(informal) An [[informal]] [[conversation]]."},
+		Verb:           []string{"To talk in an [[informal]] [[way]]."},
+		Links:          []string{"informal", "conversation", "informal", "manner"},
+		Inflections:    []string{"chats", "chatting", "chatted"},
+		Pronunciations: []string{"/tʃæt/"},
+		Etymologies:    []string{"Clipping of chatter."},
+	}
+
+	if !reflect.DeepEqual(*entry, expected) {
+		t.Errorf("got entry %+v, expected %+v", *entry, expected)
+	}
+
+	if _, err := parser.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF after the only page, got %v", err)
+	}
+}